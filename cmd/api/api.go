@@ -0,0 +1,75 @@
+// Package api holds the parts of the to-do API that do not depend on a web
+// framework: tokens, query parameters, request bodies and error responses.
+// The echo and gin handlers are both built on it so they answer alike.
+package api
+
+import (
+	"final/cmd/echo/models"
+	"final/cmd/service"
+	"io"
+	"net/http"
+)
+
+// Dependencies are what the handlers of either router need.
+type Dependencies struct {
+	Todos   service.TodoService
+	Users   service.UserService
+	Exports service.ExportService
+	Tokens  *TokenIssuer
+	Weather models.WeatherProvider
+}
+
+// NewDependencies backs the services with repos.
+func NewDependencies(repos models.Repositories, tokens *TokenIssuer, credentials *service.CredentialCache, weather models.WeatherProvider) Dependencies {
+	return Dependencies{
+		Todos:   service.NewTodoService(repos),
+		Users:   service.NewUserService(repos, credentials),
+		Exports: service.NewExportService(repos),
+		Tokens:  tokens,
+		Weather: weather,
+	}
+}
+
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// MaxImportSize limits the request body of an import.
+const MaxImportSize = 10 << 20
+
+// ImportBody is the request body of an import, cut off after MaxImportSize
+// bytes. The parsers turn the read error into a 400 like any broken file, so
+// the handlers ask TooLarge afterwards to answer 413 instead.
+type ImportBody struct {
+	body io.ReadCloser
+	read int64
+	err  error
+}
+
+func NewImportBody(w http.ResponseWriter, body io.ReadCloser) *ImportBody {
+	return &ImportBody{body: http.MaxBytesReader(w, body, MaxImportSize)}
+}
+
+func (b *ImportBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// TooLarge reports whether reading stopped at the size limit.
+func (b *ImportBody) TooLarge() bool {
+	return b.err != nil && b.read >= MaxImportSize
+}
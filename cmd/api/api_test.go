@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"final/cmd/echo/models"
+	"final/cmd/internal/testdb"
+	"final/cmd/service"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	tokens := NewTokenIssuer([]byte("test secret"), 15*time.Minute, time.Hour)
+	alice := models.User{ID: 1, Username: "alice"}
+
+	pair, err := tokens.Issue(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 900, pair.ExpiresIn)
+
+	claims, err := tokens.Parse(pair.AccessToken, AccessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", claims.Username)
+		assert.Equal(t, "1", claims.Subject)
+	}
+	_, err = tokens.Parse(pair.AccessToken, RefreshToken)
+	assert.Error(t, err, "an access token must not pass as a refresh token")
+
+	tokens.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, err := tokens.Issue(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tokens.Parse(expired.AccessToken, AccessToken)
+	assert.Error(t, err)
+
+	_, err = NewTokenIssuer([]byte("other secret"), time.Minute, time.Hour).Parse(pair.AccessToken, AccessToken)
+	assert.Error(t, err)
+}
+
+func TestVerifyToken(t *testing.T) {
+	_, repos := testdb.New(t)
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	tokens := NewTokenIssuer([]byte("test secret"), 15*time.Minute, time.Hour)
+
+	pair, err := tokens.Issue(models.User{ID: 1, Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := service.NewUserService(repos, nil)
+	ctx := context.Background()
+	claims, user, err := VerifyToken(ctx, users, tokens, pair.AccessToken, AccessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", user.Username)
+	}
+
+	if err := RevokeToken(ctx, users, claims); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyToken(ctx, users, tokens, pair.AccessToken, AccessToken)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	assert.Equal(t, ErrInvalidToken, RedeemToken(ctx, users, claims), "a revoked token cannot be redeemed")
+
+	assert.Equal(t, ErrInvalidToken, RevokeRefreshToken(ctx, users, tokens, pair.RefreshToken, models.User{ID: 2}))
+	assert.NoError(t, RevokeRefreshToken(ctx, users, tokens, pair.RefreshToken, models.User{ID: 1}))
+	_, _, err = VerifyToken(ctx, users, tokens, pair.RefreshToken, RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestPasswordChangeInvalidatesTokens(t *testing.T) {
+	_, repos := testdb.New(t)
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	tokens := NewTokenIssuer([]byte("test secret"), 15*time.Minute, time.Hour)
+	users := service.NewUserService(repos, nil)
+	ctx := context.Background()
+
+	tokens.now = func() time.Time { return time.Now().Add(-time.Minute) }
+	old, err := tokens.Issue(models.User{ID: 1, Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyToken(ctx, users, tokens, old.RefreshToken, RefreshToken); err != nil {
+		t.Fatalf("expected the refresh token to be valid before the change, got %v", err)
+	}
+
+	alice, _ := users.User(ctx, 1)
+	if err := users.ChangePassword(ctx, alice, "alicepass", "newpassword"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyToken(ctx, users, tokens, old.RefreshToken, RefreshToken)
+	assert.Equal(t, ErrInvalidToken, err, "a refresh token from before the change is refused")
+	_, _, err = VerifyToken(ctx, users, tokens, old.AccessToken, AccessToken)
+	assert.Equal(t, ErrInvalidToken, err, "an access token from before the change is refused")
+
+	tokens.now = time.Now
+	fresh, _ := tokens.Issue(alice)
+	_, _, err = VerifyToken(ctx, users, tokens, fresh.RefreshToken, RefreshToken)
+	assert.NoError(t, err, "tokens issued after the change are accepted")
+}
+
+func TestParsePageQuery(t *testing.T) {
+	query, err := ParseTaskQuery(url.Values{"limit": {"10"}, "sort": {"-created"}, "q": {"milk"}, "completed": {"true"}})
+	if assert.NoError(t, err) && assert.NotNil(t, query.Completed) {
+		assert.Equal(t, 10, query.Limit)
+		assert.Equal(t, "-created", query.Sort)
+		assert.Equal(t, "milk", query.Search)
+		assert.True(t, *query.Completed)
+	}
+
+	for _, params := range []url.Values{{"limit": {"0"}}, {"limit": {"ten"}}, {"completed": {"maybe"}}} {
+		_, err := ParseTaskQuery(params)
+		var invalid *models.ValidationError
+		assert.ErrorAs(t, err, &invalid, params.Encode())
+	}
+
+	u, _ := url.Parse("/api/lists?limit=2&cursor=old")
+	assert.Equal(t, `</api/lists?cursor=new&limit=2>; rel="next"`, NextPageLink(*u, "new"))
+}
+
+func TestParseDueQuery(t *testing.T) {
+	query, err := ParseDueQuery(url.Values{"due": {"today"}, "tz": {"Europe/Skopje"}, "completed": {"false"}})
+	if assert.NoError(t, err) && assert.NotNil(t, query.Completed) {
+		assert.Equal(t, models.DueToday, query.Due)
+		assert.Equal(t, "Europe/Skopje", query.Location.String())
+		assert.False(t, *query.Completed)
+	}
+
+	query, err = ParseDueQuery(url.Values{"due": {"week"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.UTC, query.Location)
+		assert.Nil(t, query.Completed)
+	}
+
+	for _, params := range []url.Values{{"tz": {"Mars/Olympus"}}, {"completed": {"maybe"}}} {
+		_, err := ParseDueQuery(params)
+		var invalid *models.ValidationError
+		assert.ErrorAs(t, err, &invalid, params.Encode())
+	}
+}
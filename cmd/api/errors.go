@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"final/cmd/echo/models"
+	"final/cmd/service"
+	"net/http"
+)
+
+// ErrorResponse is the JSON body of every failed API request.
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// StatusError is an error answered with a fixed status code and message.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrUnauthorized       = &StatusError{Code: http.StatusUnauthorized, Message: http.StatusText(http.StatusUnauthorized)}
+	ErrNotFound           = &StatusError{Code: http.StatusNotFound, Message: http.StatusText(http.StatusNotFound)}
+	ErrUnsupportedMedia   = &StatusError{Code: http.StatusUnsupportedMediaType, Message: http.StatusText(http.StatusUnsupportedMediaType)}
+	ErrTooLarge           = &StatusError{Code: http.StatusRequestEntityTooLarge, Message: http.StatusText(http.StatusRequestEntityTooLarge)}
+	ErrInvalidToken       = &StatusError{Code: http.StatusUnauthorized, Message: "invalid or expired token"}
+	ErrInvalidCredentials = &StatusError{Code: http.StatusUnauthorized, Message: "invalid username or password"}
+)
+
+// Error maps err to the response answering it. Unknown errors become a 500
+// without details, so internals do not leak to clients.
+func Error(err error) ErrorResponse {
+	var validationErr *models.ValidationError
+	var statusErr *StatusError
+
+	switch {
+	case errors.As(err, &validationErr):
+		return ErrorResponse{Code: http.StatusBadRequest, Message: validationErr.Message, Field: validationErr.Field}
+	case errors.Is(err, service.ErrNotOwned):
+		return ErrorResponse{Code: http.StatusNotFound, Message: ErrNotFound.Message}
+	case errors.Is(err, service.ErrWrongPassword):
+		return ErrorResponse{Code: http.StatusForbidden, Message: service.ErrWrongPassword.Error()}
+	case errors.Is(err, models.ErrNotFound):
+		return ErrorResponse{Code: http.StatusNotFound, Message: err.Error()}
+	case errors.Is(err, models.ErrConflict):
+		return ErrorResponse{Code: http.StatusConflict, Message: err.Error()}
+	case errors.Is(err, models.ErrWeatherNotConfigured):
+		return ErrorResponse{Code: http.StatusServiceUnavailable, Message: models.ErrWeatherNotConfigured.Error()}
+	case errors.Is(err, models.ErrWeatherTimeout):
+		return ErrorResponse{Code: http.StatusGatewayTimeout, Message: models.ErrWeatherTimeout.Error()}
+	case errors.Is(err, models.ErrWeatherUnavailable):
+		return ErrorResponse{Code: http.StatusBadGateway, Message: models.ErrWeatherUnavailable.Error()}
+	case errors.As(err, &statusErr):
+		return ErrorResponse{Code: statusErr.Code, Message: statusErr.Message}
+	default:
+		return ErrorResponse{Code: http.StatusInternalServerError, Message: http.StatusText(http.StatusInternalServerError)}
+	}
+}
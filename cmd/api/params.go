@@ -0,0 +1,129 @@
+package api
+
+import (
+	"final/cmd/echo/models"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseID reads the integer id in param, reporting field when it is not one.
+func ParseID(field, param string) (int, error) {
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, &models.ValidationError{Field: field, Message: "must be an integer"}
+	}
+	return id, nil
+}
+
+// ParseBool reads an optional true or false query parameter.
+func ParseBool(field, param string) (bool, error) {
+	if param == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, &models.ValidationError{Field: field, Message: "must be true or false"}
+	}
+	return value, nil
+}
+
+// ParsePageQuery reads the limit, cursor, sort and q query parameters. Without
+// a limit or cursor every row is returned, as before pagination existed.
+func ParsePageQuery(params url.Values) (models.PageQuery, error) {
+	query := models.PageQuery{
+		Cursor: params.Get("cursor"),
+		Sort:   params.Get("sort"),
+		Search: params.Get("q"),
+	}
+	if param := params.Get("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			return query, &models.ValidationError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", models.MaxPageSize)}
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// ParseTaskQuery is ParsePageQuery plus the completed filter of task listings.
+func ParseTaskQuery(params url.Values) (models.PageQuery, error) {
+	query, err := ParsePageQuery(params)
+	if err != nil {
+		return query, err
+	}
+	if param := params.Get("completed"); param != "" {
+		completed, err := ParseBool("completed", param)
+		if err != nil {
+			return query, err
+		}
+		query.Completed = &completed
+	}
+	return query, nil
+}
+
+// ParseDueQuery reads the due, tz and completed query parameters of the due
+// task views. tz is an IANA time zone such as Europe/Skopje that decides
+// where days start; it defaults to UTC. The zones come from the host's
+// zoneinfo or, in the servers, from the embedded time/tzdata.
+func ParseDueQuery(params url.Values) (models.DueQuery, error) {
+	query := models.DueQuery{Due: params.Get("due"), Location: time.UTC}
+	if param := params.Get("tz"); param != "" {
+		location, err := time.LoadLocation(param)
+		if err != nil {
+			return query, &models.ValidationError{Field: "tz", Message: "must be an IANA time zone"}
+		}
+		query.Location = location
+	}
+	if param := params.Get("completed"); param != "" {
+		completed, err := ParseBool("completed", param)
+		if err != nil {
+			return query, err
+		}
+		query.Completed = &completed
+	}
+	return query, nil
+}
+
+// NextPageLink is the Link header pointing from the page at u to the page
+// starting at cursor next.
+func NextPageLink(u url.URL, next string) string {
+	params := u.Query()
+	params.Set("cursor", next)
+	u.RawQuery = params.Encode()
+	return fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI())
+}
+
+// ParseSearchLimit reads the optional limit of a search; 0 means the default.
+func ParseSearchLimit(param string) (int, error) {
+	if param == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit < 1 {
+		return 0, &models.ValidationError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", models.MaxSearchLimit)}
+	}
+	return limit, nil
+}
+
+// ExportFormat looks up the format query parameter of an export, csv when empty.
+func ExportFormat(name string) (models.ExportFormat, error) {
+	if name == "" {
+		name = "csv"
+	}
+	return models.LookupExportFormat(name)
+}
+
+// ImportFormat looks up the format query parameter of an import. It wins over
+// the Content-Type of the body, which picks json or else csv.
+func ImportFormat(name, contentType string) (models.ExportFormat, error) {
+	if name == "" {
+		name = "csv"
+		if strings.HasPrefix(contentType, "application/json") {
+			name = "json"
+		}
+	}
+	return models.LookupExportFormat(name)
+}
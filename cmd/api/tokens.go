@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"final/cmd/echo/models"
+	"final/cmd/service"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// TokenClaims are the claims of both access and refresh tokens. Type tells them
+// apart so a refresh token cannot be used to call the API.
+type TokenClaims struct {
+	Username string `json:"username"`
+	Type     string `json:"typ"`
+	jwt.StandardClaims
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// TokenIssuer signs and verifies HS256 tokens.
+type TokenIssuer struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+func NewTokenIssuer(secret []byte, accessTTL, refreshTTL time.Duration) *TokenIssuer {
+	return &TokenIssuer{
+		secret:     secret,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+	}
+}
+
+func (ti *TokenIssuer) Issue(user models.User) (TokenPair, error) {
+	access, err := ti.sign(user, AccessToken, ti.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := ti.sign(user, RefreshToken, ti.refreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(ti.accessTTL.Seconds()),
+	}, nil
+}
+
+// Parse verifies the signature, expiry and type of token. It does not consult
+// the revocation list.
+func (ti *TokenIssuer) Parse(token, tokenType string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return ti.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("expected a %s token, got %q", tokenType, claims.Type)
+	}
+	return claims, nil
+}
+
+func (ti *TokenIssuer) sign(user models.User, tokenType string, ttl time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := ti.now()
+	claims := TokenClaims{
+		Username: user.Username,
+		Type:     tokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        hex.EncodeToString(jti),
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ti.secret)
+}
+
+// BearerToken extracts the token of an "Authorization: Bearer" header value.
+func BearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return header[len(prefix):], true
+}
+
+// VerifyToken parses token and looks up its user. Tokens that are malformed,
+// expired, revoked or of another type, whose user is gone or issued before
+// the user last changed the password, fail with ErrInvalidToken.
+func VerifyToken(ctx context.Context, users service.UserService, tokens *TokenIssuer, token, tokenType string) (*TokenClaims, models.User, error) {
+	claims, err := tokens.Parse(token, tokenType)
+	if err != nil {
+		return nil, models.User{}, ErrInvalidToken
+	}
+
+	revoked, err := users.IsTokenRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, models.User{}, err
+	}
+	if revoked {
+		return nil, models.User{}, ErrInvalidToken
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, models.User{}, ErrInvalidToken
+	}
+	user, err := users.User(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, models.User{}, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, models.User{}, err
+	}
+	// IssuedAt has whole seconds, so a token from the second of the change
+	// is still accepted; the new one issued right after must be
+	if user.PasswordChangedAt != nil && claims.IssuedAt < user.PasswordChangedAt.Unix() {
+		return nil, models.User{}, ErrInvalidToken
+	}
+	return claims, user, nil
+}
+
+// RevokeToken puts the token of claims on the revocation list until it expires.
+func RevokeToken(ctx context.Context, users service.UserService, claims *TokenClaims) error {
+	_, err := users.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	return err
+}
+
+// RedeemToken revokes the token of claims like RevokeToken, but fails with
+// ErrInvalidToken when it was revoked already. VerifyToken only saw the token
+// valid a moment ago, so of concurrent requests with the same refresh token
+// exactly one gets through.
+func RedeemToken(ctx context.Context, users service.UserService, claims *TokenClaims) error {
+	revoked, err := users.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RevokeRefreshToken revokes a refresh token presented on logout. It must be a
+// valid refresh token of user.
+func RevokeRefreshToken(ctx context.Context, users service.UserService, tokens *TokenIssuer, token string, user models.User) error {
+	claims, err := tokens.Parse(token, RefreshToken)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if claims.Subject != strconv.Itoa(user.ID) {
+		return ErrInvalidToken
+	}
+	return RevokeToken(ctx, users, claims)
+}
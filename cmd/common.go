@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"context"
 	_ "embed"
+	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/flowchartsman/swaggerui"
 )
@@ -10,12 +14,44 @@ import (
 //go:embed swagger.json
 var spec []byte
 
+// ReadinessCheck is one dependency /readyz probes. Check returns details to
+// include in the report, or an error when the dependency is not ready.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) (map[string]interface{}, error)
+}
+
+// readinessTimeout bounds all checks of one /readyz request.
+const readinessTimeout = 2 * time.Second
+
+// readiness holds the checks of /readyz. They are registered here rather
+// than passed to CreateCommonMux, whose call in the mains stays as it is.
+var readiness struct {
+	sync.Mutex
+	checks []ReadinessCheck
+}
+
+// RegisterReadinessCheck adds a check to every /readyz answer.
+func RegisterReadinessCheck(check ReadinessCheck) {
+	readiness.Lock()
+	defer readiness.Unlock()
+	readiness.checks = append(readiness.checks, check)
+}
+
+func readinessChecks() []ReadinessCheck {
+	readiness.Lock()
+	defer readiness.Unlock()
+	return append([]ReadinessCheck(nil), readiness.checks...)
+}
+
 func CreateCommonMux(h http.Handler) http.Handler {
 	r := http.NewServeMux()
 	fs := http.FileServer(http.Dir("./client/build/static"))
 	r.Handle("/swagger/", http.StripPrefix("/swagger", swaggerui.Handler(spec)))
 	r.HandleFunc("/app/", index)
 	r.Handle("/static/", http.StripPrefix("/static/", fs))
+	r.HandleFunc("/healthz", healthz)
+	r.HandleFunc("/readyz", readyz)
 
 	r.Handle("/api/", h)
 
@@ -25,3 +61,40 @@ func CreateCommonMux(h http.Handler) http.Handler {
 func index(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./client/build/index.html")
 }
+
+// healthz answers as long as the process serves requests at all.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// readyz runs every registered check and answers 503 when one of them fails.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	code, status := http.StatusOK, "ok"
+	report := map[string]interface{}{}
+	for _, check := range readinessChecks() {
+		details, err := check.Check(ctx)
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		if err != nil {
+			code, status = http.StatusServiceUnavailable, "unavailable"
+			details["status"] = "unavailable"
+			details["error"] = err.Error()
+		} else {
+			details["status"] = "ok"
+		}
+		report[check.Name] = details
+	}
+
+	writeStatus(w, code, map[string]interface{}{"status": status, "checks": report})
+}
+
+func writeStatus(w http.ResponseWriter, code int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
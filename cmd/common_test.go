@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func get(t *testing.T, h http.Handler, target string) (int, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+	return rec.Code, body
+}
+
+// registerChecks replaces the registered readiness checks for one test.
+func registerChecks(t *testing.T, checks ...ReadinessCheck) {
+	readiness.Lock()
+	saved := readiness.checks
+	readiness.checks = nil
+	readiness.Unlock()
+	t.Cleanup(func() {
+		readiness.Lock()
+		readiness.checks = saved
+		readiness.Unlock()
+	})
+
+	for _, check := range checks {
+		RegisterReadinessCheck(check)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	registerChecks(t)
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux := CreateCommonMux(api)
+
+	code, body := get(t, mux, "/healthz")
+	if code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("unexpected answer %d %v", code, body)
+	}
+
+	code, body = get(t, mux, "/readyz")
+	if code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("expected a server without checks to be ready, got %d %v", code, body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	failing := false
+	checks := []ReadinessCheck{
+		{Name: "database", Check: func(ctx context.Context) (map[string]interface{}, error) {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("expected checks to run with a deadline")
+			}
+			return map[string]interface{}{"schemaVersion": 4}, nil
+		}},
+		{Name: "cache", Check: func(ctx context.Context) (map[string]interface{}, error) {
+			if failing {
+				return nil, errors.New("connection refused")
+			}
+			return nil, nil
+		}},
+	}
+	registerChecks(t, checks...)
+	mux := CreateCommonMux(http.NotFoundHandler())
+
+	code, body := get(t, mux, "/readyz")
+	if code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("unexpected answer %d %v", code, body)
+	}
+	database := body["checks"].(map[string]interface{})["database"].(map[string]interface{})
+	if database["status"] != "ok" || database["schemaVersion"] != 4.0 {
+		t.Fatalf("expected the check details, got %v", database)
+	}
+
+	failing = true
+	code, body = get(t, mux, "/readyz")
+	if code != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+		t.Fatalf("expected a failing check to make the server unready, got %d %v", code, body)
+	}
+	cache := body["checks"].(map[string]interface{})["cache"].(map[string]interface{})
+	if cache["status"] != "unavailable" || cache["error"] != "connection refused" {
+		t.Fatalf("expected the error to be reported, got %v", cache)
+	}
+}
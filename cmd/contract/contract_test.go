@@ -0,0 +1,556 @@
+// Package contract runs the same HTTP scenarios against the echo and the gin
+// router, so the two servers cannot drift apart. Every scenario gets a fresh
+// database per router.
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"final/cmd/api"
+	echohandlers "final/cmd/echo/handlers"
+	"final/cmd/echo/models"
+	ginhandlers "final/cmd/gin/handlers"
+	"final/cmd/internal/testdb"
+	"final/cmd/service"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var routers = []struct {
+	name      string
+	newRouter func(api.Dependencies) http.Handler
+}{
+	{"echo", func(deps api.Dependencies) http.Handler { return echohandlers.NewRouter(deps) }},
+	{"gin", func(deps api.Dependencies) http.Handler { return ginhandlers.NewRouter(deps) }},
+}
+
+// server is one router under test together with its database.
+type server struct {
+	t       *testing.T
+	handler http.Handler
+	weather *fakeWeather
+}
+
+// forEachRouter runs scenario as a subtest once per router.
+func forEachRouter(t *testing.T, scenario func(t *testing.T, s *server)) {
+	for _, router := range routers {
+		router := router
+		t.Run(router.name, func(t *testing.T) {
+			_, repos := testdb.New(t)
+			weather := &fakeWeather{}
+			s := &server{t: t, weather: weather}
+			tokens := api.NewTokenIssuer([]byte("contract secret"), 15*time.Minute, time.Hour)
+			s.handler = router.newRouter(api.NewDependencies(repos, tokens, service.NewCredentialCache(time.Minute), weather))
+			scenario(t, s)
+		})
+	}
+}
+
+// auth adds credentials to a request.
+type auth func(req *http.Request)
+
+func basic(username, password string) auth {
+	return func(req *http.Request) { req.SetBasicAuth(username, password) }
+}
+
+func bearer(token string) auth {
+	return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+}
+
+var anonymous auth = func(req *http.Request) {}
+
+// call sends a JSON request; contentType overrides the JSON Content-Type.
+func (s *server) call(method, target, body string, as auth, contentType ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType[0])
+	}
+	as(req)
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *server) signUp(username, password string) models.User {
+	rec := s.call(http.MethodPost, "/api/users", fmt.Sprintf(`{"username": %q, "password": %q}`, username, password), anonymous)
+	var user models.User
+	s.decode(rec, http.StatusCreated, &user)
+	return user
+}
+
+func (s *server) createList(as auth, name string) int {
+	var list struct {
+		ID int `json:"id"`
+	}
+	s.decode(s.call(http.MethodPost, "/api/lists", fmt.Sprintf(`{"name": %q}`, name), as), http.StatusOK, &list)
+	return list.ID
+}
+
+func (s *server) createTask(as auth, listID int, text string) models.Task {
+	var task models.Task
+	s.decode(s.call(http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", listID), fmt.Sprintf(`{"text": %q}`, text), as), http.StatusOK, &task)
+	return task
+}
+
+// decode checks the status and JSON Content-Type of rec and decodes its body.
+func (s *server) decode(rec *httptest.ResponseRecorder, status int, v interface{}) {
+	s.t.Helper()
+	if !assert.Equal(s.t, status, rec.Code, rec.Body.String()) {
+		s.t.FailNow()
+	}
+	assert.True(s.t, strings.HasPrefix(strings.ToLower(rec.Header().Get("Content-Type")), "application/json"), rec.Header().Get("Content-Type"))
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		s.t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+}
+
+// fails checks that rec is the error response want.
+func (s *server) fails(rec *httptest.ResponseRecorder, want api.ErrorResponse) {
+	s.t.Helper()
+	var got api.ErrorResponse
+	s.decode(rec, want.Code, &got)
+	if want.Message == "" {
+		want.Message = got.Message
+	}
+	assert.Equal(s.t, want, got)
+}
+
+func TestSignUp(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		alice := s.signUp("alice", "alicepass")
+		assert.Equal(t, models.User{ID: 1, Username: "alice"}, alice)
+
+		s.fails(s.call(http.MethodPost, "/api/users", `{"username": "alice", "password": "otherpass"}`, anonymous),
+			api.ErrorResponse{Code: http.StatusConflict})
+		s.fails(s.call(http.MethodPost, "/api/users", `{"username": "a", "password": "alicepass"}`, anonymous),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "username", Message: "must be 3 to 32 letters, digits, '.', '-' or '_'"})
+		s.fails(s.call(http.MethodPost, "/api/users", `{"username": "bob", "password": "short"}`, anonymous),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "password", Message: "must be at least 8 characters long"})
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+
+		rec := s.call(http.MethodGet, "/api/lists", "", anonymous)
+		s.fails(rec, api.ErrorResponse{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		assert.Equal(t, "basic realm=Restricted", rec.Header().Get("WWW-Authenticate"))
+
+		rec = s.call(http.MethodGet, "/api/lists", "", basic("alice", "wrongpass"))
+		s.fails(rec, api.ErrorResponse{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		assert.Equal(t, "basic realm=Restricted", rec.Header().Get("WWW-Authenticate"))
+
+		var lists []models.List
+		s.decode(s.call(http.MethodGet, "/api/lists", "", basic("alice", "alicepass")), http.StatusOK, &lists)
+		assert.Empty(t, lists)
+	})
+}
+
+func TestTokens(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+
+		s.fails(s.call(http.MethodPost, "/api/auth/login", `{"username": "alice", "password": "wrongpass"}`, anonymous),
+			api.ErrorResponse{Code: http.StatusUnauthorized, Message: "invalid username or password"})
+
+		var pair api.TokenPair
+		s.decode(s.call(http.MethodPost, "/api/auth/login", `{"username": "alice", "password": "alicepass"}`, anonymous), http.StatusOK, &pair)
+		assert.Equal(t, "Bearer", pair.TokenType)
+		assert.Equal(t, 900, pair.ExpiresIn)
+
+		assert.Equal(t, http.StatusOK, s.call(http.MethodGet, "/api/lists", "", bearer(pair.AccessToken)).Code)
+		rec := s.call(http.MethodGet, "/api/lists", "", bearer(pair.RefreshToken))
+		s.fails(rec, api.ErrorResponse{Code: http.StatusUnauthorized, Message: "invalid or expired token"})
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+		var refreshed api.TokenPair
+		refresh := fmt.Sprintf(`{"refreshToken": %q}`, pair.RefreshToken)
+		s.decode(s.call(http.MethodPost, "/api/auth/refresh", refresh, anonymous), http.StatusOK, &refreshed)
+		s.fails(s.call(http.MethodPost, "/api/auth/refresh", refresh, anonymous),
+			api.ErrorResponse{Code: http.StatusUnauthorized, Message: "invalid or expired token"})
+
+		rec = s.call(http.MethodPost, "/api/auth/logout", fmt.Sprintf(`{"refreshToken": %q}`, refreshed.RefreshToken), bearer(refreshed.AccessToken))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, s.call(http.MethodGet, "/api/lists", "", bearer(refreshed.AccessToken)).Code)
+		assert.Equal(t, http.StatusUnauthorized, s.call(http.MethodPost, "/api/auth/refresh", fmt.Sprintf(`{"refreshToken": %q}`, refreshed.RefreshToken), anonymous).Code)
+
+		assert.Equal(t, http.StatusNoContent, s.call(http.MethodPost, "/api/auth/logout", "", basic("alice", "alicepass")).Code)
+	})
+}
+
+func TestRefreshTokenIsRedeemedOnce(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		var pair api.TokenPair
+		s.decode(s.call(http.MethodPost, "/api/auth/login", `{"username": "alice", "password": "alicepass"}`, anonymous), http.StatusOK, &pair)
+
+		refresh := fmt.Sprintf(`{"refreshToken": %q}`, pair.RefreshToken)
+		codes := make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				codes <- s.call(http.MethodPost, "/api/auth/refresh", refresh, anonymous).Code
+			}()
+		}
+		got := []int{<-codes, <-codes}
+		assert.ElementsMatch(t, []int{http.StatusOK, http.StatusUnauthorized}, got, "exactly one refresh may succeed")
+	})
+}
+
+func TestAccount(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		alice := s.signUp("alice", "alicepass")
+
+		s.fails(s.call(http.MethodPut, "/api/users/me/password", `{"currentPassword": "guess", "newPassword": "newalicepass"}`, basic("alice", "alicepass")),
+			api.ErrorResponse{Code: http.StatusForbidden, Message: "current password is incorrect"})
+		s.fails(s.call(http.MethodPut, "/api/users/me/password", `{"currentPassword": "alicepass", "newPassword": "short"}`, basic("alice", "alicepass")),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "password"})
+
+		rec := s.call(http.MethodPut, "/api/users/me/password", `{"currentPassword": "alicepass", "newPassword": "newalicepass"}`, basic("alice", "alicepass"))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, http.StatusUnauthorized, s.call(http.MethodGet, "/api/lists", "", basic("alice", "alicepass")).Code)
+		assert.Equal(t, http.StatusOK, s.call(http.MethodGet, "/api/lists", "", basic("alice", "newalicepass")).Code)
+
+		var deleted map[string]int
+		s.decode(s.call(http.MethodDelete, "/api/users/me", "", basic("alice", "newalicepass")), http.StatusOK, &deleted)
+		assert.Equal(t, map[string]int{"deleted": alice.ID}, deleted)
+		assert.Equal(t, http.StatusUnauthorized, s.call(http.MethodGet, "/api/lists", "", basic("alice", "newalicepass")).Code)
+	})
+}
+
+func TestListsAndTasks(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		alice := basic("alice", "alicepass")
+
+		var created map[string]interface{}
+		s.decode(s.call(http.MethodPost, "/api/lists", `{"name": "groceries"}`, alice), http.StatusOK, &created)
+		assert.Equal(t, map[string]interface{}{"id": float64(1), "name": "groceries"}, created)
+
+		var list models.List
+		s.decode(s.call(http.MethodPut, "/api/lists/1", `{"name": "shopping"}`, alice), http.StatusOK, &list)
+		assert.Equal(t, "shopping", list.Name)
+		s.decode(s.call(http.MethodPatch, "/api/lists/1", `{"name": "food"}`, alice), http.StatusOK, &list)
+		s.decode(s.call(http.MethodGet, "/api/lists/1", "", alice), http.StatusOK, &list)
+		assert.Equal(t, "food", list.Name)
+
+		milk := s.createTask(alice, 1, "milk")
+		assert.Equal(t, "milk", milk.Name)
+		assert.Equal(t, 1, milk.ListID)
+		s.createTask(alice, 1, "bread")
+
+		var task models.Task
+		s.decode(s.call(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", milk.ID), `{"completed": true}`, alice), http.StatusOK, &task)
+		assert.True(t, task.Completed)
+		assert.NotNil(t, task.CompletedAt)
+		s.decode(s.call(http.MethodGet, fmt.Sprintf("/api/tasks/%d", milk.ID), "", alice), http.StatusOK, &task)
+		assert.Equal(t, "milk", task.Name)
+
+		var tasks []models.Task
+		s.decode(s.call(http.MethodGet, "/api/lists/1/tasks?completed=false", "", alice), http.StatusOK, &tasks)
+		if assert.Len(t, tasks, 1) {
+			assert.Equal(t, "bread", tasks[0].Name)
+		}
+
+		var deleted map[string]int
+		s.decode(s.call(http.MethodDelete, fmt.Sprintf("/api/tasks/%d", milk.ID), "", alice), http.StatusOK, &deleted)
+		assert.Equal(t, map[string]int{"deleted": milk.ID}, deleted)
+		deleted = nil
+		s.decode(s.call(http.MethodDelete, "/api/lists/1", "", alice), http.StatusOK, &deleted)
+		assert.Equal(t, map[string]int{"deleted": 1, "tasksDeleted": 1}, deleted)
+
+		var lists []models.List
+		s.decode(s.call(http.MethodGet, "/api/lists", "", alice), http.StatusOK, &lists)
+		assert.Empty(t, lists)
+	})
+}
+
+func TestTrash(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		s.signUp("bob", "bobpass1")
+		alice, bob := basic("alice", "alicepass"), basic("bob", "bobpass1")
+
+		groceries := s.createList(alice, "groceries")
+		chores := s.createList(alice, "chores")
+		milk := s.createTask(alice, groceries, "milk")
+		s.createTask(alice, chores, "dishes")
+		s.call(http.MethodDelete, fmt.Sprintf("/api/tasks/%d", milk.ID), "", alice)
+		s.call(http.MethodDelete, fmt.Sprintf("/api/lists/%d", chores), "", alice)
+
+		var trash models.Trash
+		s.decode(s.call(http.MethodGet, "/api/trash", "", alice), http.StatusOK, &trash)
+		if assert.Len(t, trash.Lists, 1) && assert.Len(t, trash.Tasks, 1) {
+			assert.Equal(t, chores, trash.Lists[0].ID)
+			assert.NotNil(t, trash.Lists[0].DeletedAt)
+			assert.Equal(t, milk.ID, trash.Tasks[0].ID)
+			assert.NotNil(t, trash.Tasks[0].DeletedAt)
+		}
+		var lists []models.List
+		s.decode(s.call(http.MethodGet, "/api/lists", "", alice), http.StatusOK, &lists)
+		assert.Len(t, lists, 1)
+		assert.JSONEq(t, `{"lists": [], "tasks": []}`, s.call(http.MethodGet, "/api/trash", "", bob).Body.String())
+
+		notFound := api.ErrorResponse{Code: http.StatusNotFound, Message: "Not Found"}
+		s.fails(s.call(http.MethodPost, fmt.Sprintf("/api/trash/lists/%d/restore", chores), "", bob), notFound)
+		s.fails(s.call(http.MethodPost, fmt.Sprintf("/api/trash/lists/%d/restore", groceries), "", alice), notFound)
+		s.fails(s.call(http.MethodPost, "/api/trash/lists/x/restore", "", alice), api.ErrorResponse{Code: http.StatusBadRequest, Field: "id"})
+
+		taken := s.createList(alice, "chores")
+		assert.Equal(t, http.StatusConflict, s.call(http.MethodPost, fmt.Sprintf("/api/trash/lists/%d/restore", chores), "", alice).Code)
+		assert.Equal(t, http.StatusOK, s.call(http.MethodPatch, fmt.Sprintf("/api/lists/%d", taken), `{"name": "more chores"}`, alice).Code)
+
+		var list models.List
+		s.decode(s.call(http.MethodPost, fmt.Sprintf("/api/trash/lists/%d/restore", chores), "", alice), http.StatusOK, &list)
+		assert.Equal(t, "chores", list.Name)
+		assert.Nil(t, list.DeletedAt)
+		var tasks []models.Task
+		s.decode(s.call(http.MethodGet, fmt.Sprintf("/api/lists/%d/tasks", chores), "", alice), http.StatusOK, &tasks)
+		assert.Len(t, tasks, 1, "the tasks come back with their list")
+
+		var task models.Task
+		s.decode(s.call(http.MethodPost, fmt.Sprintf("/api/trash/tasks/%d/restore", milk.ID), "", alice), http.StatusOK, &task)
+		assert.Equal(t, "milk", task.Name)
+		s.fails(s.call(http.MethodPost, fmt.Sprintf("/api/trash/tasks/%d/restore", milk.ID), "", alice), notFound)
+		s.decode(s.call(http.MethodGet, "/api/trash", "", alice), http.StatusOK, &trash)
+		assert.Empty(t, trash.Lists)
+		assert.Empty(t, trash.Tasks)
+	})
+}
+
+func TestDueTasks(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		s.signUp("bob", "bobpass1")
+		alice, bob := basic("alice", "alicepass"), basic("bob", "bobpass1")
+		work := s.createList(alice, "work")
+
+		late := time.Now().UTC().Add(-48 * time.Hour).Format(time.RFC3339)
+		soon := time.Now().UTC().Add(48 * time.Hour).Format(time.RFC3339)
+		var report, trip models.Task
+		s.decode(s.call(http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", work), fmt.Sprintf(`{"text": "report", "dueAt": %q}`, late), alice), http.StatusOK, &report)
+		s.decode(s.call(http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", work), fmt.Sprintf(`{"text": "trip", "dueAt": %q, "remindAt": %q}`, soon, soon), alice), http.StatusOK, &trip)
+		assert.NotNil(t, trip.RemindAt)
+		s.createTask(alice, work, "some day")
+
+		var tasks []models.Task
+		s.decode(s.call(http.MethodGet, "/api/tasks?due=overdue", "", alice), http.StatusOK, &tasks)
+		if assert.Len(t, tasks, 1) {
+			assert.Equal(t, report.ID, tasks[0].ID)
+		}
+		s.decode(s.call(http.MethodGet, "/api/tasks?due=week&tz=Europe/Skopje", "", alice), http.StatusOK, &tasks)
+		if assert.Len(t, tasks, 1) {
+			assert.Equal(t, trip.ID, tasks[0].ID)
+		}
+		s.decode(s.call(http.MethodGet, "/api/tasks?due=overdue", "", bob), http.StatusOK, &tasks)
+		assert.Empty(t, tasks)
+
+		s.fails(s.call(http.MethodGet, "/api/tasks", "", alice), api.ErrorResponse{Code: http.StatusBadRequest, Field: "due"})
+		s.fails(s.call(http.MethodGet, "/api/tasks?due=tomorrow", "", alice), api.ErrorResponse{Code: http.StatusBadRequest, Field: "due"})
+		s.fails(s.call(http.MethodGet, "/api/tasks?due=today&tz=Mars/Olympus", "", alice), api.ErrorResponse{Code: http.StatusBadRequest, Field: "tz"})
+		s.fails(s.call(http.MethodGet, "/api/tasks?due=overdue&completed=true", "", alice), api.ErrorResponse{Code: http.StatusBadRequest, Field: "completed"})
+
+		var task models.Task
+		s.decode(s.call(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", trip.ID), `{"dueAt": null}`, alice), http.StatusOK, &task)
+		assert.Nil(t, task.DueAt)
+		assert.NotNil(t, task.RemindAt)
+		s.decode(s.call(http.MethodGet, "/api/tasks?due=week", "", alice), http.StatusOK, &tasks)
+		assert.Empty(t, tasks)
+	})
+}
+
+func TestOwnership(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		s.signUp("bob", "bobpass1")
+		alice, bob := basic("alice", "alicepass"), basic("bob", "bobpass1")
+
+		aliceList := s.createList(alice, "private")
+		task := s.createTask(alice, aliceList, "secret")
+		bobList := s.createList(bob, "mine")
+
+		notFound := api.ErrorResponse{Code: http.StatusNotFound, Message: "Not Found"}
+		s.fails(s.call(http.MethodGet, fmt.Sprintf("/api/lists/%d", aliceList), "", bob), notFound)
+		s.fails(s.call(http.MethodGet, fmt.Sprintf("/api/lists/%d/tasks", aliceList), "", bob), notFound)
+		s.fails(s.call(http.MethodDelete, fmt.Sprintf("/api/lists/%d", aliceList), "", bob), notFound)
+		s.fails(s.call(http.MethodGet, fmt.Sprintf("/api/tasks/%d", task.ID), "", bob), notFound)
+		s.fails(s.call(http.MethodGet, fmt.Sprintf("/api/list/export?list=%d", aliceList), "", bob), notFound)
+
+		s.fails(s.call(http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), fmt.Sprintf(`{"listId": %d}`, bobList), alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "listId", Message: "no such list"})
+	})
+}
+
+func TestErrorResponses(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		alice := basic("alice", "alicepass")
+		listID := s.createList(alice, "mine")
+
+		s.fails(s.call(http.MethodGet, "/api/lists/abc/tasks", "", alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "id", Message: "must be an integer"})
+		s.fails(s.call(http.MethodPost, "/api/lists", `{"name": ""}`, alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "name", Message: "must not be empty"})
+		s.fails(s.call(http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", listID), `{"text": ""}`, alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "text", Message: "must not be empty"})
+		s.fails(s.call(http.MethodPost, "/api/lists", `{"name": `, alice),
+			api.ErrorResponse{Code: http.StatusBadRequest})
+		s.fails(s.call(http.MethodPost, "/api/lists", `{"name": 7}`, alice),
+			api.ErrorResponse{Code: http.StatusBadRequest})
+		s.fails(s.call(http.MethodPost, "/api/lists", `<name>x</name>`, alice, "text/plain"),
+			api.ErrorResponse{Code: http.StatusUnsupportedMediaType, Message: "Unsupported Media Type"})
+		s.fails(s.call(http.MethodDelete, "/api/tasks/42", "", alice),
+			api.ErrorResponse{Code: http.StatusNotFound, Message: "Not Found"})
+		s.fails(s.call(http.MethodGet, "/api/lists?limit=0", "", alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", models.MaxPageSize)})
+		s.fails(s.call(http.MethodGet, "/api/list/export?format=xml", "", alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "format"})
+		s.fails(s.call(http.MethodGet, "/api/nowhere", "", alice),
+			api.ErrorResponse{Code: http.StatusNotFound, Message: "Not Found"})
+		s.fails(s.call(http.MethodPost, "/api/tasks/1", "", alice),
+			api.ErrorResponse{Code: http.StatusNotFound, Message: "Not Found"})
+		s.fails(s.call(http.MethodGet, "/api/nowhere", "", anonymous),
+			api.ErrorResponse{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+	})
+}
+
+func TestPagination(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		alice := basic("alice", "alicepass")
+		for i := 1; i <= 5; i++ {
+			s.createList(alice, fmt.Sprintf("list %d", i))
+		}
+
+		var names []string
+		target := "/api/lists?limit=2&sort=-name"
+		for pages := 0; target != ""; pages++ {
+			if pages > 3 {
+				t.Fatal("pagination does not end")
+			}
+			rec := s.call(http.MethodGet, target, "", alice)
+			var lists []models.List
+			s.decode(rec, http.StatusOK, &lists)
+			for _, list := range lists {
+				names = append(names, list.Name)
+			}
+
+			target = ""
+			if link := rec.Header().Get("Link"); link != "" {
+				assert.NotEmpty(t, rec.Header().Get("X-Next-Cursor"))
+				target = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+		}
+		assert.Equal(t, []string{"list 5", "list 4", "list 3", "list 2", "list 1"}, names)
+	})
+}
+
+func TestExportAndImport(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		s.signUp("bob", "bobpass1")
+		alice, bob := basic("alice", "alicepass"), basic("bob", "bobpass1")
+		inbox := s.createList(bob, "inbox")
+		s.createTask(bob, inbox, "one")
+		s.createTask(bob, inbox, "two")
+
+		rec := s.call(http.MethodGet, "/api/list/export", "", bob)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="tasks.csv"`, rec.Header().Get("Content-Disposition"))
+		exported := rec.Body.String()
+
+		var report models.ImportReport
+		s.decode(s.call(http.MethodPost, "/api/import?dryRun=true", exported, alice, "text/csv"), http.StatusOK, &report)
+		assert.Equal(t, models.ImportReport{DryRun: true, ListsCreated: []string{"inbox"}, ListsReused: []string{}, TasksCreated: 2, Errors: []models.ImportError{}}, report)
+
+		s.decode(s.call(http.MethodPost, "/api/import", exported, alice, "text/csv"), http.StatusCreated, &report)
+		assert.Equal(t, 2, report.TasksCreated)
+
+		var tasks []models.ExportedTask
+		rec = s.call(http.MethodGet, "/api/list/export?format=json", "", alice)
+		s.decode(rec, http.StatusOK, &tasks)
+		assert.Equal(t, `attachment; filename="tasks.json"`, rec.Header().Get("Content-Disposition"))
+		if assert.Len(t, tasks, 2) {
+			assert.Equal(t, "inbox", tasks[0].ListName)
+			assert.Equal(t, "one", tasks[0].Text)
+		}
+
+		s.decode(s.call(http.MethodPost, "/api/import", `[{"listName": "work", "text": ""}]`, alice), http.StatusBadRequest, &report)
+		assert.Equal(t, []models.ImportError{{Row: 1, Field: "text", Message: "must not be empty"}}, report.Errors)
+
+		oversized := "list,text\n" + strings.Repeat("work,"+strings.Repeat("x", 1000)+"\n", api.MaxImportSize/1000)
+		s.fails(s.call(http.MethodPost, "/api/import", oversized, alice, "text/csv"), api.ErrorResponse{Code: http.StatusRequestEntityTooLarge, Message: "Request Entity Too Large"})
+	})
+}
+
+func TestSearch(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		alice := basic("alice", "alicepass")
+		listID := s.createList(alice, "groceries")
+		s.createTask(alice, listID, "buy oat milk")
+		s.createTask(alice, listID, "bread")
+
+		var results []models.SearchResult
+		s.decode(s.call(http.MethodGet, "/api/search?q=mil", "", alice), http.StatusOK, &results)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "buy oat milk", results[0].Task.Name)
+			assert.Equal(t, "groceries", results[0].ListName)
+		}
+
+		s.fails(s.call(http.MethodGet, "/api/search", "", alice), api.ErrorResponse{Code: http.StatusBadRequest, Field: "q", Message: "must not be empty"})
+	})
+}
+
+func TestWeather(t *testing.T) {
+	forEachRouter(t, func(t *testing.T, s *server) {
+		s.signUp("alice", "alicepass")
+		alice := basic("alice", "alicepass")
+		s.weather.info = models.WeatherInfo{FormatedTemp: "20.0 °C", Temperature: 20, Unit: "°C", Description: "clear sky", Icon: "01d", City: "Skopje"}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/weather?units=metric", nil)
+		req.Header.Set("lat", "41.99")
+		req.Header.Set("lon", "21")
+		alice(req)
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		var info models.WeatherInfo
+		s.decode(rec, http.StatusOK, &info)
+		assert.Equal(t, s.weather.info, info)
+		assert.Equal(t, models.WeatherRequest{Lat: 41.99, Lon: 21, Units: "metric"}, s.weather.request)
+
+		s.fails(s.call(http.MethodGet, "/api/weather?lat=100&lon=21", "", alice),
+			api.ErrorResponse{Code: http.StatusBadRequest, Field: "lat", Message: "must be a number between -90 and 90"})
+
+		s.weather.err = fmt.Errorf("%w: deadline exceeded", models.ErrWeatherTimeout)
+		s.fails(s.call(http.MethodGet, "/api/weather?lat=1&lon=2", "", alice),
+			api.ErrorResponse{Code: http.StatusGatewayTimeout, Message: models.ErrWeatherTimeout.Error()})
+	})
+}
+
+type fakeWeather struct {
+	info    models.WeatherInfo
+	err     error
+	request models.WeatherRequest
+}
+
+func (f *fakeWeather) CurrentWeather(ctx context.Context, request models.WeatherRequest) (models.WeatherInfo, error) {
+	f.request = request
+	return f.info, f.err
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
@@ -0,0 +1,306 @@
+// Package config loads the settings of the echo and gin servers. Every setting has a
+// default, which an optional YAML or JSON file, then environment variables and
+// finally command line flags override. The server always listens on :3000.
+package config
+
+import (
+	"errors"
+	"final/cmd/echo/models"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// Store is sql for the database at DBPath, or memory for an empty store
+	// that lives as long as the process, e.g. for demos.
+	Store string `yaml:"store"`
+	// DBPath is the path of a SQLite database or a postgres:// URL.
+	DBPath     string `yaml:"dbPath"`
+	BcryptCost int    `yaml:"bcryptCost"`
+
+	// ShutdownTimeout is how long in-flight requests may take to finish after
+	// SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	// Seed creates SeedUsers on startup unless they exist.
+	Seed      bool       `yaml:"seed"`
+	SeedUsers []SeedUser `yaml:"seedUsers"`
+
+	// JWTSecret signs tokens. When empty a random key is used, so tokens do
+	// not survive a restart.
+	JWTSecret          string        `yaml:"jwtSecret"`
+	AccessTokenTTL     time.Duration `yaml:"accessTokenTTL"`
+	RefreshTokenTTL    time.Duration `yaml:"refreshTokenTTL"`
+	CredentialCacheTTL time.Duration `yaml:"credentialCacheTTL"`
+
+	// TrashRetention is how long deleted lists and tasks can be restored. A
+	// purge every TrashPurgeInterval deletes older ones for good.
+	TrashRetention     time.Duration `yaml:"trashRetention"`
+	TrashPurgeInterval time.Duration `yaml:"trashPurgeInterval"`
+
+	Weather   Weather   `yaml:"weather"`
+	Reminders Reminders `yaml:"reminders"`
+
+	// Migrate, MigrateSteps and PrintConfig select what the process does and
+	// are only read from the command line.
+	Migrate      string `yaml:"-"`
+	MigrateSteps int    `yaml:"-"`
+	PrintConfig  bool   `yaml:"-"`
+}
+
+type SeedUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type Weather struct {
+	APIKey   string        `yaml:"apiKey"`
+	URL      string        `yaml:"url"`
+	Timeout  time.Duration `yaml:"timeout"`
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+}
+
+// Reminders are looked for every Interval. With a WebhookURL each one is
+// posted there, otherwise it is only logged.
+type Reminders struct {
+	Interval       time.Duration `yaml:"interval"`
+	WebhookURL     string        `yaml:"webhookURL"`
+	WebhookTimeout time.Duration `yaml:"webhookTimeout"`
+}
+
+func Default() Config {
+	return Config{
+		Store:      "sql",
+		DBPath:     "data.db",
+		BcryptCost: 14,
+
+		ShutdownTimeout: 15 * time.Second,
+		SeedUsers: []SeedUser{
+			{Username: "filipb", Password: "blabla"},
+			{Username: "dada", Password: "blabla"},
+		},
+		AccessTokenTTL:     15 * time.Minute,
+		RefreshTokenTTL:    7 * 24 * time.Hour,
+		CredentialCacheTTL: 30 * time.Second,
+		TrashRetention:     30 * 24 * time.Hour,
+		TrashPurgeInterval: time.Hour,
+		Weather: Weather{
+			URL:      models.DefaultWeatherURL,
+			Timeout:  models.DefaultWeatherTimeout,
+			CacheTTL: 10 * time.Minute,
+		},
+		Reminders: Reminders{
+			Interval:       time.Minute,
+			WebhookTimeout: 10 * time.Second,
+		},
+		Migrate:      "up",
+		MigrateSteps: 1,
+	}
+}
+
+// environment maps flags to the environment variables setting them.
+var environment = []struct{ flag, env string }{
+	{"store", "STORE"},
+	{"db", "DB_PATH"},
+	{"bcrypt-cost", "BCRYPT_COST"},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT"},
+	{"seed", "SEED_DEMO_USERS"},
+	{"jwt-secret", "JWT_SECRET"},
+	{"access-token-ttl", "ACCESS_TOKEN_TTL"},
+	{"refresh-token-ttl", "REFRESH_TOKEN_TTL"},
+	{"credential-cache-ttl", "CREDENTIAL_CACHE_TTL"},
+	{"trash-retention", "TRASH_RETENTION"},
+	{"trash-purge-interval", "TRASH_PURGE_INTERVAL"},
+	{"weather-api-key", "OPENWEATHERMAP_API_KEY"},
+	{"weather-url", "OPENWEATHERMAP_URL"},
+	{"weather-timeout", "OPENWEATHERMAP_TIMEOUT"},
+	{"weather-cache-ttl", "WEATHER_CACHE_TTL"},
+	{"reminder-interval", "REMINDER_INTERVAL"},
+	{"reminder-webhook-url", "REMINDER_WEBHOOK_URL"},
+	{"reminder-webhook-timeout", "REMINDER_WEBHOOK_TIMEOUT"},
+}
+
+func newFlagSet(name string, cfg *Config, file *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(file, "config", *file, "YAML or JSON configuration file (env CONFIG_FILE)")
+	fs.StringVar(&cfg.Store, "store", cfg.Store, "where data is kept: sql, or memory to lose it on exit (env STORE)")
+	fs.StringVar(&cfg.DBPath, "db", cfg.DBPath, "path of the SQLite database or a postgres:// URL (env DB_PATH)")
+	fs.IntVar(&cfg.BcryptCost, "bcrypt-cost", cfg.BcryptCost, "bcrypt cost of new password hashes (env BCRYPT_COST)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long in-flight requests may take to finish on shutdown (env SHUTDOWN_TIMEOUT)")
+	fs.BoolVar(&cfg.Seed, "seed", cfg.Seed, "create the demo users on startup (env SEED_DEMO_USERS)")
+	fs.StringVar(&cfg.JWTSecret, "jwt-secret", cfg.JWTSecret, "token signing key, random when empty (env JWT_SECRET)")
+	fs.DurationVar(&cfg.AccessTokenTTL, "access-token-ttl", cfg.AccessTokenTTL, "lifetime of access tokens (env ACCESS_TOKEN_TTL)")
+	fs.DurationVar(&cfg.RefreshTokenTTL, "refresh-token-ttl", cfg.RefreshTokenTTL, "lifetime of refresh tokens (env REFRESH_TOKEN_TTL)")
+	fs.DurationVar(&cfg.CredentialCacheTTL, "credential-cache-ttl", cfg.CredentialCacheTTL, "how long verified basic auth credentials are remembered (env CREDENTIAL_CACHE_TTL)")
+	fs.DurationVar(&cfg.TrashRetention, "trash-retention", cfg.TrashRetention, "how long deleted lists and tasks can be restored (env TRASH_RETENTION)")
+	fs.DurationVar(&cfg.TrashPurgeInterval, "trash-purge-interval", cfg.TrashPurgeInterval, "how often expired lists and tasks are purged from the trash (env TRASH_PURGE_INTERVAL)")
+	fs.StringVar(&cfg.Weather.APIKey, "weather-api-key", cfg.Weather.APIKey, "OpenWeatherMap API key (env OPENWEATHERMAP_API_KEY)")
+	fs.StringVar(&cfg.Weather.URL, "weather-url", cfg.Weather.URL, "OpenWeatherMap API base URL (env OPENWEATHERMAP_URL)")
+	fs.DurationVar(&cfg.Weather.Timeout, "weather-timeout", cfg.Weather.Timeout, "timeout of OpenWeatherMap requests (env OPENWEATHERMAP_TIMEOUT)")
+	fs.DurationVar(&cfg.Weather.CacheTTL, "weather-cache-ttl", cfg.Weather.CacheTTL, "how long weather answers are cached (env WEATHER_CACHE_TTL)")
+	fs.DurationVar(&cfg.Reminders.Interval, "reminder-interval", cfg.Reminders.Interval, "how often due task reminders are sent (env REMINDER_INTERVAL)")
+	fs.StringVar(&cfg.Reminders.WebhookURL, "reminder-webhook-url", cfg.Reminders.WebhookURL, "URL reminders are posted to; they are only logged without one (env REMINDER_WEBHOOK_URL)")
+	fs.DurationVar(&cfg.Reminders.WebhookTimeout, "reminder-webhook-timeout", cfg.Reminders.WebhookTimeout, "timeout of reminder webhook requests (env REMINDER_WEBHOOK_TIMEOUT)")
+	fs.StringVar(&cfg.Migrate, "migrate", cfg.Migrate, "schema migration to run before serving: up, or down/status to run and exit")
+	fs.IntVar(&cfg.MigrateSteps, "steps", cfg.MigrateSteps, "number of migrations to revert with -migrate=down")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", cfg.PrintConfig, "print the effective configuration and exit")
+	return fs
+}
+
+// Load reads the configuration from the command line arguments args, the
+// environment variables returned by getenv and the file named by -config or
+// CONFIG_FILE.
+func Load(name string, args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	// the first pass only finds the file; flags are parsed again after the file
+	// and the environment so that they win
+	file := getenv("CONFIG_FILE")
+	scratch := Default()
+	if err := newFlagSet(name, &scratch, &file).Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if file != "" {
+		if err := loadFile(&cfg, file); err != nil {
+			return cfg, err
+		}
+	}
+
+	fs := newFlagSet(name, &cfg, &file)
+	for _, setting := range environment {
+		if value := getenv(setting.env); value != "" {
+			if err := fs.Set(setting.flag, value); err != nil {
+				return cfg, fmt.Errorf("%s: %w", setting.env, err)
+			}
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile reads a YAML file. JSON is valid YAML, so JSON files work as well.
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var problems []string
+	switch c.Store {
+	case "sql":
+		if c.DBPath == "" {
+			problems = append(problems, "dbPath must not be empty")
+		}
+	case "memory":
+		if c.Migrate != "up" {
+			problems = append(problems, "migrate=down and migrate=status need store sql")
+		}
+	default:
+		problems = append(problems, "store must be sql or memory")
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		problems = append(problems, fmt.Sprintf("bcryptCost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdownTimeout must be positive")
+	}
+	for i, user := range c.SeedUsers {
+		var invalid *models.ValidationError
+		if err := models.ValidateUsername(user.Username); errors.As(err, &invalid) {
+			problems = append(problems, fmt.Sprintf("seedUsers[%d].username %s", i, invalid.Message))
+		}
+		if user.Password == "" {
+			problems = append(problems, fmt.Sprintf("seedUsers[%d].password must not be empty", i))
+		}
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		problems = append(problems, "accessTokenTTL and refreshTokenTTL must be positive")
+	}
+	if c.CredentialCacheTTL < 0 || c.Weather.CacheTTL < 0 {
+		problems = append(problems, "credentialCacheTTL and weather.cacheTTL must not be negative")
+	}
+	if c.TrashRetention <= 0 || c.TrashPurgeInterval <= 0 {
+		problems = append(problems, "trashRetention and trashPurgeInterval must be positive")
+	}
+	if u, err := url.Parse(c.Weather.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "weather.url must be an http or https URL")
+	}
+	if c.Weather.Timeout <= 0 {
+		problems = append(problems, "weather.timeout must be positive")
+	}
+	if c.Reminders.Interval <= 0 || c.Reminders.WebhookTimeout <= 0 {
+		problems = append(problems, "reminders.interval and reminders.webhookTimeout must be positive")
+	}
+	if c.Reminders.WebhookURL != "" {
+		if u, err := url.Parse(c.Reminders.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, "reminders.webhookURL must be an http or https URL")
+		}
+	}
+	switch c.Migrate {
+	case "up", "down", "status":
+	default:
+		problems = append(problems, "migrate must be up, down or status")
+	}
+	if c.MigrateSteps < 1 {
+		problems = append(problems, "steps must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// String returns the configuration as YAML with secrets masked.
+func (c Config) String() string {
+	mask := func(secret string) string {
+		if secret == "" {
+			return ""
+		}
+		return "********"
+	}
+
+	c.JWTSecret = mask(c.JWTSecret)
+	if u, err := url.Parse(c.DBPath); err == nil && u.User != nil {
+		c.DBPath = u.Redacted()
+	}
+	c.Weather.APIKey = mask(c.Weather.APIKey)
+	// webhook URLs often carry a token
+	c.Reminders.WebhookURL = mask(c.Reminders.WebhookURL)
+	users := make([]SeedUser, len(c.SeedUsers))
+	for i, user := range c.SeedUsers {
+		users[i] = SeedUser{Username: user.Username, Password: mask(user.Password)}
+	}
+	c.SeedUsers = users
+
+	var out strings.Builder
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err.Error()
+	}
+	return out.String()
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"final/cmd/api"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HTTPErrorHandler is installed as echo.Echo.HTTPErrorHandler. It maps model
+// errors to status codes so handlers can simply return them.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	response := errorResponse(err)
+	if response.Code >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(response.Code)
+	} else {
+		err = c.JSON(response.Code, response)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+func errorResponse(err error) api.ErrorResponse {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return api.ErrorResponse{Code: httpErr.Code, Message: fmt.Sprint(httpErr.Message)}
+	}
+	return api.Error(err)
+}
@@ -1,165 +1,425 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
+	"final/cmd/api"
 	"final/cmd/echo/models"
+	"final/cmd/service"
+	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 type H map[string]interface{}
 
-var loggedUser models.User
+// userKey is the echo.Context key holding the authenticated models.User of a request.
+const userKey = "user"
 
-func AuthenticateUser(db *sql.DB, username string, password string) (bool, error) {
-	rows, err := db.Query("SELECT * FROM users")
-	if err != nil {
-		panic(err)
+func SetUser(c echo.Context, user models.User) {
+	c.Set(userKey, user)
+}
+
+func CurrentUser(c echo.Context) models.User {
+	user, _ := c.Get(userKey).(models.User)
+	return user
+}
+
+// BasicAuthValidator checks credentials with users.
+func BasicAuthValidator(users service.UserService) middleware.BasicAuthValidator {
+	return func(username, password string, c echo.Context) (bool, error) {
+		user, ok, err := users.Authenticate(c.Request().Context(), username, password)
+		if ok {
+			SetUser(c, user)
+		}
+		return ok, err
 	}
+}
+
+func paramID(c echo.Context) (int, error) {
+	return api.ParseID("id", c.Param("id"))
+}
+
+func GetTasks(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		listID, err := paramID(c)
+
+		if err != nil {
+			return err
+		}
 
-	defer rows.Close()
-	for rows.Next() {
-		user := models.User{}
-		err2 := rows.Scan(&user.ID, &user.Username, &user.Password)
-		if err2 != nil {
-			panic(err2)
+		query, err := api.ParseTaskQuery(c.QueryParams())
+		if err != nil {
+			return err
 		}
-		err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 
-		if username == user.Username && err == nil {
-			loggedUser = user
-			return true, nil
+		tasks, next, err := todos.Tasks(c.Request().Context(), CurrentUser(c), listID, query)
+
+		if err != nil {
+			return err
 		}
+		setNextPage(c, next)
+		return c.JSON(http.StatusOK, tasks)
 	}
+}
 
-	return false, nil
+// setNextPage points the client to the next page with a Link header and the
+// bare cursor in X-Next-Cursor. The body stays a plain JSON array.
+func setNextPage(c echo.Context, next string) {
+	if next == "" {
+		return
+	}
+	header := c.Response().Header()
+	header.Set("Link", api.NextPageLink(*c.Request().URL, next))
+	header.Set("X-Next-Cursor", next)
 }
 
-func GetTasks(db *sql.DB) echo.HandlerFunc {
+func GetTask(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		listID, err := strconv.Atoi(c.Param("id"))
+		id, err := paramID(c)
 
 		if err != nil {
 			return err
 		}
 
-		return c.JSON(http.StatusOK, models.GetTasks(db, listID))
+		task, err := todos.Task(c.Request().Context(), CurrentUser(c), id)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, task)
 	}
 }
 
-func CreateTask(db *sql.DB) echo.HandlerFunc {
+func CreateTask(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		task := models.Task{}
-		c.Bind(&task)
-		listID, err := strconv.Atoi(c.Param("id"))
+		task := models.NewTask{}
+		if err := c.Bind(&task); err != nil {
+			return err
+		}
+		listID, err := paramID(c)
 
 		if err != nil {
 			return err
 		}
 
-		myTask, err := models.CreateTask(db, task.Name, listID)
+		myTask, err := todos.CreateTask(c.Request().Context(), CurrentUser(c), listID, task)
 
-		if err == nil {
-			return c.JSON(http.StatusOK, myTask)
-		} else {
+		if err != nil {
 			return err
 		}
+		return c.JSON(http.StatusOK, myTask)
 	}
 }
 
-func UpdateTask(db *sql.DB) echo.HandlerFunc {
+func UpdateTask(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		id, err := strconv.Atoi(c.Param("id"))
+		id, err := paramID(c)
 
 		if err != nil {
 			return err
 		}
-		task, err := models.UpdateTask(db, id)
 
-		if err == nil {
-			return c.JSON(http.StatusOK, task)
-		} else {
+		var update models.TaskUpdate
+		if err := c.Bind(&update); err != nil {
+			return err
+		}
+
+		task, err := todos.UpdateTask(c.Request().Context(), CurrentUser(c), id, update)
+
+		if err != nil {
 			return err
 		}
+		return c.JSON(http.StatusOK, task)
 	}
 }
 
-func DeleteTask(db *sql.DB) echo.HandlerFunc {
+func DeleteTask(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		id, _ := strconv.Atoi(c.Param("id"))
+		id, err := paramID(c)
 
-		_, err := models.DeleteTask(db, id)
+		if err != nil {
+			return err
+		}
 
-		if err == nil {
-			return c.JSON(http.StatusOK, H{
-				"deleted": id,
-			})
+		err = todos.DeleteTask(c.Request().Context(), CurrentUser(c), id)
 
-		} else {
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, H{
+			"deleted": id,
+		})
+	}
+}
+
+// ExportTasks streams the current user's tasks as a download. The format query
+// parameter picks csv (default), json, markdown or ical, and list restricts the
+// export to one list.
+func ExportTasks(exports service.ExportService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		format, err := api.ExportFormat(c.QueryParam("format"))
+		if err != nil {
 			return err
 		}
 
+		listID := 0
+		if param := c.QueryParam("list"); param != "" {
+			listID, err = api.ParseID("list", param)
+			if err != nil {
+				return err
+			}
+		}
+
+		header := c.Response().Header()
+		header.Set(echo.HeaderContentType, format.ContentType)
+		header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "tasks."+format.Extension))
+
+		err = exports.Export(c.Request().Context(), CurrentUser(c), c.Response(), format, listID)
+		if err != nil && !c.Response().Committed {
+			header.Del(echo.HeaderContentType)
+			header.Del(echo.HeaderContentDisposition)
+		}
+		return err
 	}
 }
 
-func ExportTasks(db *sql.DB) echo.HandlerFunc {
+// SearchTasks finds the current user's tasks matching the q query parameter
+// in all of their lists, best matches first.
+func SearchTasks(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		err := models.ExportTasksCSV(db, loggedUser)
+		limit, err := api.ParseSearchLimit(c.QueryParam("limit"))
 		if err != nil {
-			panic(err)
+			return err
 		}
-		return c.JSON(http.StatusOK, "successful operation")
+
+		results, err := todos.Search(c.Request().Context(), CurrentUser(c), c.QueryParam("q"), limit)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, results)
 	}
 }
 
-func GetLists(db *sql.DB) echo.HandlerFunc {
+// DueTasks lists the current user's tasks due today, in the next week or
+// overdue, across all of their lists, soonest first.
+func DueTasks(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return c.JSON(http.StatusOK, models.GetLists(db, loggedUser))
+		query, err := api.ParseDueQuery(c.QueryParams())
+		if err != nil {
+			return err
+		}
+
+		tasks, err := todos.DueTasks(c.Request().Context(), CurrentUser(c), query)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, tasks)
 	}
 }
 
-func CreateList(db *sql.DB) echo.HandlerFunc {
+// ImportTasks creates lists and tasks from a csv or json file in the export
+// format. The format query parameter wins over the Content-Type of the body.
+// With dryRun=true nothing is stored and the report says what would have been
+// created. Any invalid row rejects the whole import.
+func ImportTasks(exports service.ExportService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		format, err := api.ImportFormat(c.QueryParam("format"), c.Request().Header.Get(echo.HeaderContentType))
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := api.ParseBool("dryRun", c.QueryParam("dryRun"))
+		if err != nil {
+			return err
+		}
+
+		body := api.NewImportBody(c.Response(), c.Request().Body)
+		report, err := exports.Import(c.Request().Context(), CurrentUser(c), body, format, dryRun)
+		if body.TooLarge() {
+			return api.ErrTooLarge
+		}
+		if errors.Is(err, service.ErrImportRejected) {
+			return c.JSON(http.StatusBadRequest, report)
+		}
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return c.JSON(http.StatusOK, report)
+		}
+		return c.JSON(http.StatusCreated, report)
+	}
+}
+
+func GetLists(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query, err := api.ParsePageQuery(c.QueryParams())
+		if err != nil {
+			return err
+		}
+
+		lists, next, err := todos.Lists(c.Request().Context(), CurrentUser(c), query)
+
+		if err != nil {
+			return err
+		}
+		setNextPage(c, next)
+		return c.JSON(http.StatusOK, lists)
+	}
+}
+
+func CreateList(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var list models.List
-		c.Bind(&list)
+		if err := c.Bind(&list); err != nil {
+			return err
+		}
+
+		created, err := todos.CreateList(c.Request().Context(), CurrentUser(c), list.Name)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, H{
+			"id":   created.ID,
+			"name": created.Name,
+		})
+	}
+}
+
+func GetList(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := paramID(c)
+
+		if err != nil {
+			return err
+		}
+
+		list, err := todos.List(c.Request().Context(), CurrentUser(c), id)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// UpdateList renames a list. It serves both PUT and PATCH, as name is the only
+// editable field.
+func UpdateList(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := paramID(c)
+
+		if err != nil {
+			return err
+		}
+
+		var list models.List
+		if err := c.Bind(&list); err != nil {
+			return err
+		}
+
+		renamed, err := todos.RenameList(c.Request().Context(), CurrentUser(c), id, list.Name)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, renamed)
+	}
+}
 
-		id, err := models.CreateList(db, list.Name, loggedUser)
+func DeleteList(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := paramID(c)
 
-		if err == nil {
-			return c.JSON(http.StatusOK, H{
-				"id":   id,
-				"name": list.Name,
-			})
-		} else {
+		if err != nil {
 			return err
 		}
 
+		tasks, err := todos.DeleteList(c.Request().Context(), CurrentUser(c), id)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, H{
+			"deleted":      id,
+			"tasksDeleted": tasks,
+		})
+	}
+}
+
+func GetTrash(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		trash, err := todos.Trash(c.Request().Context(), CurrentUser(c))
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, trash)
 	}
 }
 
-func DeleteList(db *sql.DB) echo.HandlerFunc {
+func RestoreList(todos service.TodoService) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		id, _ := strconv.Atoi(c.Param("id"))
-		err := models.DeleteList(db, id)
+		id, err := paramID(c)
 
-		if err == nil {
-			return c.JSON(http.StatusOK, H{
-				"deleted": id,
-			})
-		} else {
+		if err != nil {
 			return err
 		}
 
+		list, err := todos.RestoreList(c.Request().Context(), CurrentUser(c), id)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, list)
 	}
 }
 
-func GetWeather() echo.HandlerFunc {
+func RestoreTask(todos service.TodoService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := paramID(c)
+
+		if err != nil {
+			return err
+		}
+
+		task, err := todos.RestoreTask(c.Request().Context(), CurrentUser(c), id)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, task)
+	}
+}
+
+// GetWeather reports the weather at the position in the lat and lon headers,
+// or query parameters of the same name. The units and lang query parameters
+// choose the temperature unit and the language of the description.
+func GetWeather(weather models.WeatherProvider) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		lat := c.Request().Header.Get("lat")
+		if lat == "" {
+			lat = c.QueryParam("lat")
+		}
 		lon := c.Request().Header.Get("lon")
-		return c.JSON(http.StatusOK, models.GetWeather(lat, lon))
+		if lon == "" {
+			lon = c.QueryParam("lon")
+		}
+		request, err := models.ParseWeatherRequest(lat, lon, c.QueryParam("units"), c.QueryParam("lang"))
+		if err != nil {
+			return err
+		}
+
+		info, err := weather.CurrentWeather(c.Request().Context(), request)
+
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, info)
 	}
 }
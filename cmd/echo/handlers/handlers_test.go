@@ -1,365 +1,969 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
+	"final/cmd/api"
 	"final/cmd/echo/models"
-	"log"
+	"final/cmd/internal/testdb"
+	"final/cmd/service"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateTask(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		log.Println(err)
-	}
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	e := newTestRouter(repos)
 
-	migrate(db)
+	rec := send(e, http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", list.ID), `{"text": "test"}`, "alice", "alicepass")
 
-	task := models.Task{
-		ID:        1,
-		Name:      "test",
-		ListID:    1,
-		Completed: false,
-	}
-
-	taskJson, err := json.Marshal(task)
+	tasks, _, err := repos.Tasks.Tasks(context.Background(), list.ID, models.PageQuery{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	want := string(taskJson)
-
-	_, err = db.Exec("INSERT INTO tasks (id, name,user_id) values (?,?,?)", task.ID, task.Name, task.ListID, task.Completed)
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, "test", tasks[0].Name)
+		assert.False(t, tasks[0].CreatedAt.IsZero())
+		assert.Nil(t, tasks[0].CompletedAt)
+	}
 
-	if err != nil {
-		log.Println(err)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, marshal(t, tasks[0]), rec.Body.String())
 	}
+}
 
-	e := echo.New()
+func TestGetTasks(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	task := testdb.CreateTask(t, repos, list.ID, "da")
+	other := testdb.CreateList(t, repos, alice, "other")
+	testdb.CreateTask(t, repos, other.ID, "elsewhere")
+	e := newTestRouter(repos)
 
-	body := strings.NewReader(`{"name": "test"}`)
-	req := httptest.NewRequest(http.MethodPost, "/api/lists/:id/tasks", body)
-	req.Header.Set("Content-Type", "application/json")
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.Set("user_id", 1)
-	c.SetParamNames("id")
-	c.SetParamValues("1")
+	rec := send(e, http.MethodGet, fmt.Sprintf("/api/lists/%d/tasks", list.ID), "", "alice", "alicepass")
 
-	handler := CreateList(db)(c)
-	got := rec.Body.String()
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, marshal(t, []models.Task{task}), rec.Body.String())
+	}
+}
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
+func TestPaginateTasks(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	for i := 1; i <= 5; i++ {
+		testdb.CreateTask(t, repos, list.ID, fmt.Sprintf("task %d", i))
+	}
+	completed := true
+	repos.Tasks.Update(context.Background(), 3, models.TaskUpdate{Completed: &completed})
+
+	e := newTestRouter(repos)
+	get := func(target string) *httptest.ResponseRecorder {
+		return send(e, http.MethodGet, target, "", "alice", "alicepass")
+	}
+
+	rec := get(fmt.Sprintf("/api/lists/%d/tasks", list.ID))
+	var tasks []models.Task
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tasks)) {
+		assert.Len(t, tasks, 5, "without a limit every task is returned")
+		assert.Empty(t, rec.Header().Get("Link"))
+	}
+
+	var names []string
+	target := fmt.Sprintf("/api/lists/%d/tasks?limit=2&sort=-id", list.ID)
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("expected 3 pages")
+		}
+		rec = get(target)
+		tasks = nil
+		if !assert.Equal(t, http.StatusOK, rec.Code) || !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tasks)) {
+			return
+		}
+		for _, task := range tasks {
+			names = append(names, task.Name)
+		}
+
+		target = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			assert.True(t, strings.HasSuffix(link, `>; rel="next"`), link)
+			assert.Contains(t, link, "limit=2")
+			assert.Contains(t, link, "cursor="+rec.Header().Get("X-Next-Cursor"))
+			target = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	assert.Equal(t, []string{"task 5", "task 4", "task 3", "task 2", "task 1"}, names)
+
+	rec = get(fmt.Sprintf("/api/lists/%d/tasks?completed=false&q=TASK", list.ID))
+	tasks = nil
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tasks)) {
+		assert.Len(t, tasks, 4)
+	}
+
+	rec = get("/api/lists?limit=1&sort=name&q=inb")
+	var lists []models.List
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &lists)) {
+		assert.Len(t, lists, 1)
+		assert.Empty(t, rec.Header().Get("X-Next-Cursor"))
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "limit=501", "sort=text", "completed=maybe", "cursor=abc"} {
+		assert.Equal(t, http.StatusBadRequest, get(fmt.Sprintf("/api/lists/%d/tasks?%s", list.ID, query)).Code, query)
 	}
 }
 
-func TestGetTasks(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
+func TestUpdateTask(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	task := testdb.CreateTask(t, repos, list.ID, "test")
+	e := newTestRouter(repos)
+
+	rec := send(e, http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), `{"completed": true}`, "alice", "alicepass")
+
+	task, err := repos.Tasks.Get(context.Background(), task.ID)
 	if err != nil {
-		log.Println(err)
+		t.Fatal(err)
 	}
+	assert.True(t, task.Completed)
+	assert.NotNil(t, task.CompletedAt)
+
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, marshal(t, task), rec.Body.String())
+	}
+}
 
-	migrate(db)
+func TestUpdateTaskFields(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
 
-	task := models.Task{
-		ID:        1,
-		Name:      "da",
-		ListID:    1,
-		Completed: false,
+	inbox := testdb.CreateList(t, repos, alice, "inbox")
+	done := testdb.CreateList(t, repos, alice, "done")
+	bobs := testdb.CreateList(t, repos, bob, "bob's")
+	task := testdb.CreateTask(t, repos, inbox.ID, "write tests")
+
+	e := newTestRouter(repos)
+	patch := func(body string) (int, models.Task) {
+		rec := send(e, http.MethodPatch, fmt.Sprintf("/api/tasks/%d", task.ID), body, "alice", "alicepass")
+
+		var got models.Task
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		return rec.Code, got
 	}
 
-	taskJson, err := json.Marshal(task)
-	if err != nil {
-		t.Fatal(err)
+	for i := 0; i < 2; i++ {
+		code, got := patch(`{"completed": true}`)
+		if assert.Equal(t, http.StatusOK, code) {
+			assert.True(t, got.Completed, "completed=true must be idempotent")
+		}
 	}
-	want := string(taskJson)
 
-	_, err = db.Exec("INSERT INTO tasks (id, name,user_id) values (?,?,?)", task.ID, task.Name, task.ListID, task.Completed)
+	code, got := patch(`{"text": "write more tests"}`)
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, task.ID, got.ID)
+		assert.Equal(t, "write more tests", got.Name)
+		assert.Equal(t, inbox.ID, got.ListID)
+		assert.True(t, got.Completed)
+	}
 
-	if err != nil {
-		log.Println(err)
+	code, got = patch(fmt.Sprintf(`{"listId": %d, "completed": false}`, done.ID))
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, "write more tests", got.Name)
+		assert.Equal(t, done.ID, got.ListID)
+		assert.False(t, got.Completed)
+		assert.Nil(t, got.CompletedAt)
 	}
 
-	e := echo.New()
+	code, _ = patch(fmt.Sprintf(`{"listId": %d}`, bobs.ID))
+	assert.Equal(t, http.StatusBadRequest, code, "tasks must not move into other users' lists")
+	code, _ = patch(`{"text": ""}`)
+	assert.Equal(t, http.StatusBadRequest, code)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/lists/:id/tasks", nil)
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.SetParamNames("id")
-	c.SetParamValues("1")
-	c.Request().Header.Set("name", "da")
+	current, _ := repos.Tasks.Get(context.Background(), task.ID)
+	assert.Equal(t, done.ID, current.ListID)
+	assert.Equal(t, "write more tests", current.Name)
+}
 
-	handler := GetLists(db)(c)
-	got := rec.Body.String()
+func TestTaskJSON(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	task := testdb.CreateTask(t, repos, list.ID, "sort me")
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(marshal(t, task)), &got); err != nil {
+		t.Fatal(err)
 	}
+	for _, key := range []string{"id", "text", "listId", "completed", "createdAt", "updatedAt", "completedAt", "touched"} {
+		assert.Contains(t, got, key)
+	}
+	assert.Equal(t, float64(task.UpdatedAt.UnixMilli()), got["touched"])
 }
 
-func TestUpdateTask(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		log.Println(err)
+func TestDeleteTask(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	task := testdb.CreateTask(t, repos, list.ID, "test")
+	kept := testdb.CreateTask(t, repos, list.ID, "keep me")
+	e := newTestRouter(repos)
+
+	rec := send(e, http.MethodDelete, fmt.Sprintf("/api/tasks/%d", task.ID), "", "alice", "alicepass")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, fmt.Sprintf(`{"deleted": %d}`, task.ID), rec.Body.String())
 	}
 
-	migrate(db)
+	_, err := repos.Tasks.Get(context.Background(), task.ID)
+	assert.ErrorIs(t, err, models.ErrNotFound)
+	_, err = repos.Tasks.Get(context.Background(), kept.ID)
+	assert.NoError(t, err)
 
-	task := models.Task{
-		ID:        1,
-		Name:      "test",
-		ListID:    1,
-		Completed: false,
-	}
+	rec = send(e, http.MethodDelete, fmt.Sprintf("/api/tasks/%d", task.ID), "", "alice", "alicepass")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
 
-	_, err = db.Exec("INSERT INTO tasks (id, name,user_id) values (?,?,?)", task.ID, task.Name, task.ListID, task.Completed)
+func TestCreateList(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	e := newTestRouter(repos)
 
-	if err != nil {
-		log.Println(err)
+	rec := send(e, http.MethodPost, "/api/lists", `{"name": "test"}`, "alice", "alicepass")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, `{"id": 1, "name": "test"}`, rec.Body.String())
 	}
 
-	taskJson, err := json.Marshal(task)
+	lists, _, err := repos.Lists.Lists(context.Background(), alice, models.PageQuery{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	want := string(taskJson)
+	if assert.Len(t, lists, 1) {
+		assert.Equal(t, alice.ID, lists[0].UserID)
+	}
 
-	e := echo.New()
+	rec = send(e, http.MethodPost, "/api/lists", `{"name": "test"}`, "alice", "alicepass")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
 
-	req := httptest.NewRequest(http.MethodDelete, "/api/tasks/:id", nil)
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.SetParamNames("id")
-	c.SetParamValues("1")
+func TestGetLists(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+	list := testdb.CreateList(t, repos, alice, "test")
+	testdb.CreateList(t, repos, bob, "other")
+	e := newTestRouter(repos)
 
-	handler := UpdateTask(db)(c)
-	got := rec.Body.String()
+	rec := send(e, http.MethodGet, "/api/lists", "", "alice", "alicepass")
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, marshal(t, []models.List{list}), rec.Body.String())
 	}
 }
 
-func TestDeleteTask(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		log.Println(err)
+func TestGetList(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "inbox")
+	task := testdb.CreateTask(t, repos, list.ID, "read")
+
+	e := newTestRouter(repos)
+	get := func(target string) *httptest.ResponseRecorder {
+		return send(e, http.MethodGet, target, "", "alice", "alicepass")
 	}
 
-	migrate(db)
+	rec := get(fmt.Sprintf("/api/lists/%d", list.ID))
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, marshal(t, list), rec.Body.String())
+	}
 
-	task := models.Task{
-		ID:        1,
-		Name:      "test",
-		ListID:    1,
-		Completed: false,
+	rec = get(fmt.Sprintf("/api/tasks/%d", task.ID))
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, marshal(t, task), rec.Body.String())
 	}
 
-	_, err = db.Exec("INSERT INTO tasks (id, name,user_id) values (?,?,?)", task.ID, task.Name, task.ListID, task.Completed)
+	assert.Equal(t, http.StatusNotFound, get("/api/lists/42").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/tasks/42").Code)
+}
 
-	if err != nil {
-		log.Println(err)
+func TestUpdateList(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+	inbox := testdb.CreateList(t, repos, alice, "inbox")
+	testdb.CreateList(t, repos, alice, "work")
+	bobs := testdb.CreateList(t, repos, bob, "bob's")
+
+	e := newTestRouter(repos)
+	rename := func(method string, id int, body string) *httptest.ResponseRecorder {
+		return send(e, method, fmt.Sprintf("/api/lists/%d", id), body, "alice", "alicepass")
+	}
+
+	rec := rename(http.MethodPatch, inbox.ID, `{"name": "home"}`)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var got models.List
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, inbox.ID, got.ID)
+		assert.Equal(t, "home", got.Name)
+		assert.Equal(t, alice.ID, got.UserID)
+		assert.False(t, got.UpdatedAt.Before(got.CreatedAt))
+	}
+	assert.Equal(t, http.StatusOK, rename(http.MethodPut, inbox.ID, `{"name": "house"}`).Code)
+	assert.Equal(t, http.StatusOK, rename(http.MethodPut, inbox.ID, `{"name": "house"}`).Code, "keeping the same name is not a conflict")
+
+	assert.Equal(t, http.StatusBadRequest, rename(http.MethodPatch, inbox.ID, `{"name": "  "}`).Code)
+	assert.Equal(t, http.StatusBadRequest, rename(http.MethodPatch, inbox.ID, fmt.Sprintf(`{"name": %q}`, strings.Repeat("x", models.MaxListNameLength+1))).Code)
+	assert.Equal(t, http.StatusConflict, rename(http.MethodPatch, inbox.ID, `{"name": "work"}`).Code)
+	assert.Equal(t, http.StatusOK, rename(http.MethodPatch, inbox.ID, `{"name": "bob's"}`).Code, "names only need to be unique per user")
+	assert.Equal(t, http.StatusNotFound, rename(http.MethodPatch, bobs.ID, `{"name": "mine now"}`).Code)
+
+	list, _ := repos.Lists.Get(context.Background(), bobs.ID)
+	assert.Equal(t, "bob's", list.Name)
+}
+
+func TestDeleteList(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "test")
+	task := testdb.CreateTask(t, repos, list.ID, "goes too")
+	e := newTestRouter(repos)
+
+	rec := send(e, http.MethodDelete, fmt.Sprintf("/api/lists/%d", list.ID), "", "alice", "alicepass")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, fmt.Sprintf(`{"deleted": %d, "tasksDeleted": 1}`, list.ID), rec.Body.String())
 	}
 
-	want := string("{}")
+	assert.Equal(t, http.StatusNotFound, send(e, http.MethodGet, fmt.Sprintf("/api/tasks/%d", task.ID), "", "alice", "alicepass").Code, "the tasks of a list are deleted with it")
+	assert.Equal(t, http.StatusNotFound, send(e, http.MethodGet, fmt.Sprintf("/api/lists/%d", list.ID), "", "alice", "alicepass").Code)
+}
 
-	e := echo.New()
+// TestTaskDueDates checks that echo binds the due and reminder times of a
+// task; the due views are in the contract suite.
+func TestTaskDueDates(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	work := testdb.CreateList(t, repos, alice, "work")
+	e := newTestRouter(repos)
+
+	dueAt := time.Date(2022, 5, 12, 9, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	body := fmt.Sprintf(`{"text": "trip", "dueAt": %q, "remindAt": %q}`, dueAt.Format(time.RFC3339), dueAt.Add(-time.Hour).Format(time.RFC3339))
+	rec := send(e, http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", work.ID), body, "alice", "alicepass")
+	var trip models.Task
+	if !assert.Equal(t, http.StatusOK, rec.Code) || !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &trip)) {
+		t.FailNow()
+	}
+	if assert.NotNil(t, trip.DueAt) && assert.NotNil(t, trip.RemindAt) {
+		assert.True(t, trip.DueAt.Equal(dueAt))
+		assert.True(t, trip.RemindAt.Equal(dueAt.Add(-time.Hour)))
+	}
+
+	update := fmt.Sprintf("/api/tasks/%d", trip.ID)
+	rec = send(e, http.MethodPatch, update, `{"text": "road trip"}`, "alice", "alicepass")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.NotContains(t, rec.Body.String(), `"dueAt":null`, "an absent due time is left alone")
+	}
+	rec = send(e, http.MethodPatch, update, `{"dueAt": null}`, "alice", "alicepass")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Contains(t, rec.Body.String(), `"dueAt":null`)
+		assert.NotContains(t, rec.Body.String(), `"remindAt":null`, "the reminder is left alone")
+	}
+	assert.Equal(t, http.StatusBadRequest, send(e, http.MethodPatch, update, `{"dueAt": "tomorrow"}`, "alice", "alicepass").Code)
+}
 
-	req := httptest.NewRequest(http.MethodDelete, "/api/tasks/:id", nil)
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.SetParamNames("id")
-	c.SetParamValues("1")
+func TestConcurrentUsersDoNotShareLists(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	testdb.CreateUser(t, repos, "bob", "bobpass")
 
-	handler := DeleteTask(db)(c)
-	got := rec.Body.String()
+	e := newTestRouter(repos)
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
+	users := map[string]string{
+		"alice": "alicepass",
+		"bob":   "bobpass",
 	}
-}
 
-func TestCreateList(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		log.Println(err)
+	const perUser = 20
+	var wg sync.WaitGroup
+	for username, password := range users {
+		for i := 0; i < perUser; i++ {
+			wg.Add(1)
+			go func(username, password string, i int) {
+				defer wg.Done()
+				rec := send(e, http.MethodPost, "/api/lists", fmt.Sprintf(`{"name": "%s-%d"}`, username, i), username, password)
+				assert.Equal(t, http.StatusOK, rec.Code)
+			}(username, password, i)
+		}
 	}
+	wg.Wait()
 
-	migrate(db)
+	for username, password := range users {
+		rec := send(e, http.MethodGet, "/api/lists", "", username, password)
 
-	list := models.List{
-		ID:     1,
-		Name:   "test",
-		UserID: 1,
+		var lists []models.List
+		if err := json.Unmarshal(rec.Body.Bytes(), &lists); err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, lists, perUser)
+		for _, list := range lists {
+			assert.True(t, strings.HasPrefix(list.Name, username+"-"), "%s got list %q", username, list.Name)
+		}
 	}
+}
 
-	_, err = db.Exec("INSERT INTO lists (id, name,user_id) values (?,?,?)", list.ID, list.Name, list.UserID)
+func TestOwnershipIsEnforced(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+	bobsList := testdb.CreateList(t, repos, bob, "bob's")
+	bobsTask := testdb.CreateTask(t, repos, bobsList.ID, "secret")
 
-	if err != nil {
-		log.Println(err)
+	e := newTestRouter(repos)
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, fmt.Sprintf("/api/lists/%d/tasks", bobsList.ID), ""},
+		{http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", bobsList.ID), `{"text": "intruder"}`},
+		{http.MethodGet, fmt.Sprintf("/api/lists/%d", bobsList.ID), ""},
+		{http.MethodPatch, fmt.Sprintf("/api/lists/%d", bobsList.ID), `{"name": "mine"}`},
+		{http.MethodGet, fmt.Sprintf("/api/tasks/%d", bobsTask.ID), ""},
+		{http.MethodPatch, fmt.Sprintf("/api/tasks/%d", bobsTask.ID), `{"completed": true}`},
+		{http.MethodDelete, fmt.Sprintf("/api/tasks/%d", bobsTask.ID), ""},
+		{http.MethodDelete, fmt.Sprintf("/api/lists/%d", bobsList.ID), ""},
+		{http.MethodGet, fmt.Sprintf("/api/list/export?list=%d", bobsList.ID), ""},
+		{http.MethodGet, "/api/lists/999/tasks", ""},
 	}
 
-	listJson, err := json.Marshal(list)
+	for _, r := range requests {
+		rec := send(e, r.method, r.path, r.body, "alice", "alicepass")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code, "%s %s", r.method, r.path)
+	}
+
+	tasks, _, err := repos.Tasks.Tasks(context.Background(), bobsList.ID, models.PageQuery{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	want := string(listJson)
-	body := strings.NewReader(`{"name": "test"}`)
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, bobsTask, tasks[0])
+	}
+	list, err := repos.Lists.Get(context.Background(), bobsList.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "bob's", list.Name)
+	}
+
+	rec := send(e, http.MethodGet, fmt.Sprintf("/api/lists/%d/tasks", bobsList.ID), "", "bob", "bobpass")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestErrorResponses(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	list := testdb.CreateList(t, repos, alice, "mine")
+
+	e := newTestRouter(repos)
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+		want   api.ErrorResponse
+	}{
+		{http.MethodGet, "/api/lists/abc/tasks", "", api.ErrorResponse{Code: http.StatusBadRequest, Message: "must be an integer", Field: "id"}},
+		{http.MethodPost, "/api/lists", `{"name": ""}`, api.ErrorResponse{Code: http.StatusBadRequest, Message: "must not be empty", Field: "name"}},
+		{http.MethodPost, fmt.Sprintf("/api/lists/%d/tasks", list.ID), `{"text": ""}`, api.ErrorResponse{Code: http.StatusBadRequest, Message: "must not be empty", Field: "text"}},
+		{http.MethodPost, "/api/lists", `{"name": `, api.ErrorResponse{Code: http.StatusBadRequest}},
+		{http.MethodDelete, "/api/tasks/42", "", api.ErrorResponse{Code: http.StatusNotFound, Message: "Not Found"}},
+	}
+
+	for _, r := range requests {
+		rec := send(e, r.method, r.path, r.body, "alice", "alicepass")
+
+		var got api.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, r.want.Code, rec.Code, "%s %s", r.method, r.path)
+		assert.Equal(t, r.want.Code, got.Code, "%s %s", r.method, r.path)
+		if r.want.Message != "" {
+			assert.Equal(t, r.want, got, "%s %s", r.method, r.path)
+		}
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	errs := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("task 1 %w", models.ErrNotFound), http.StatusNotFound},
+		{fmt.Errorf("list %w", models.ErrConflict), http.StatusConflict},
+		{&models.ValidationError{Field: "name", Message: "too long"}, http.StatusBadRequest},
+		{echo.ErrUnauthorized, http.StatusUnauthorized},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodPost, "/api/lists/:id/tasks", body)
-	req.Header.Set("Content-Type", "application/json")
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.Set("user_id", 1)
+	for _, tc := range errs {
+		req := httptest.NewRequest(http.MethodGet, "/api/lists", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
 
-	handler := CreateList(db)(c)
-	got := rec.Body.String()
+		HTTPErrorHandler(tc.err, c)
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
+		var got api.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.code, rec.Code, tc.err.Error())
+		assert.Equal(t, tc.code, got.Code, tc.err.Error())
+		assert.NotContains(t, got.Message, "disk on fire")
 	}
 }
 
-func TestGetLists(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		log.Println(err)
-	}
+func TestBasicAuthUsesCredentialCache(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+
+	validate := BasicAuthValidator(service.NewUserService(repos, service.NewCredentialCache(time.Minute)))
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/lists", nil), httptest.NewRecorder())
 
-	migrate(db)
+	ok, err := validate("alice", "alicepass", c)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", CurrentUser(c).Username)
 
-	lists := []models.List{
-		{
-			ID:     1,
-			Name:   "test",
-			UserID: 1,
-		},
+	// with the account gone only the cache can still vouch for alice
+	if err := repos.Users.Delete(context.Background(), alice); err != nil {
+		t.Fatal(err)
 	}
+	ok, err = validate("alice", "alicepass", c)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = validate("alice", "guess", c)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
 
-	_, err = db.Exec("INSERT INTO lists (id, name,user_id) values (?,?,?)", lists[0].ID, lists[0].Name, lists[0].UserID)
+func TestSignUp(t *testing.T) {
+	e := newTestRouter(models.NewMemoryRepositories())
 
-	if err != nil {
-		log.Println(err)
+	signUp := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
 	}
 
-	listsJson, err := json.Marshal(lists)
-	if err != nil {
-		t.Fatal(err)
+	rec := signUp(`{"username": "alice", "password": "correct horse"}`)
+	if assert.Equal(t, http.StatusCreated, rec.Code) {
+		assert.JSONEq(t, `{"id": 1, "username": "alice"}`, rec.Body.String())
 	}
-	want := string(listsJson)
 
-	e := echo.New()
+	rec = signUp(`{"username": "alice", "password": "battery staple"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = signUp(`{"username": "bob", "password": "short"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = signUp(`{"username": "b", "password": "long enough"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/lists", nil)
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.SetParamNames("id")
-	c.SetParamValues("1")
-	c.Set("user_id", 1)
+	req.SetBasicAuth("alice", "correct horse")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
 
-	handler := GetLists(db)(c)
-	got := rec.Body.String()
+func TestChangePassword(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	e := newTestRouter(repos)
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
+	request := func(method, path, password, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth("alice", password)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
 	}
+
+	// warm up the credential cache with the old password
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/lists", "alicepass", ""))
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPut, "/api/users/me/password", "alicepass",
+		`{"currentPassword": "wrong", "newPassword": "newalicepass"}`))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/api/users/me/password", "alicepass",
+		`{"currentPassword": "alicepass", "newPassword": "short"}`))
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPut, "/api/users/me/password", "alicepass",
+		`{"currentPassword": "alicepass", "newPassword": "newalicepass"}`))
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/lists", "alicepass", ""))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/lists", "newalicepass", ""))
 }
 
-func TestDeleteList(t *testing.T) {
-	db, err := sql.Open("sqlite", ":memory:")
-	if err != nil {
-		log.Println(err)
+func TestDeleteUser(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+
+	alicesList := testdb.CreateList(t, repos, alice, "alice's")
+	alicesTask := testdb.CreateTask(t, repos, alicesList.ID, "mine")
+	bobsList := testdb.CreateList(t, repos, bob, "bob's")
+	testdb.CreateTask(t, repos, bobsList.ID, "his")
+
+	e := newTestRouter(repos)
+
+	rec := send(e, http.MethodDelete, "/api/users/me", "", "alice", "alicepass")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, fmt.Sprintf(`{"deleted": %d}`, alice.ID), rec.Body.String())
 	}
 
-	migrate(db)
+	rec = send(e, http.MethodGet, "/api/lists", "", "alice", "alicepass")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	_, err := repos.Lists.Get(context.Background(), alicesList.ID)
+	assert.ErrorIs(t, err, models.ErrNotFound)
+	_, err = repos.Tasks.Get(context.Background(), alicesTask.ID)
+	assert.ErrorIs(t, err, models.ErrNotFound)
+
+	tasks, _, _ := repos.Tasks.Tasks(context.Background(), bobsList.ID, models.PageQuery{})
+	assert.Len(t, tasks, 1, "bob's task should remain")
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	e := newTestRouter(repos)
+
+	post := func(path, body, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	getLists := func(bearer string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/lists", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	login := func() api.TokenPair {
+		rec := post("/api/auth/login", `{"username": "alice", "password": "alicepass"}`, "")
+		var pair api.TokenPair
+		if assert.Equal(t, http.StatusOK, rec.Code) {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+		}
+		return pair
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("/api/auth/login", `{"username": "alice", "password": "nope"}`, "").Code)
+
+	pair := login()
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, http.StatusOK, getLists(pair.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, getLists(pair.RefreshToken), "refresh tokens must not authorize API calls")
+	assert.Equal(t, http.StatusUnauthorized, getLists("garbage"))
+
+	rec := post("/api/auth/refresh", fmt.Sprintf(`{"refreshToken": %q}`, pair.RefreshToken), "")
+	var refreshed api.TokenPair
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &refreshed))
+	}
+	assert.Equal(t, http.StatusOK, getLists(refreshed.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, post("/api/auth/refresh", fmt.Sprintf(`{"refreshToken": %q}`, pair.RefreshToken), "").Code,
+		"refresh tokens must be single use")
+	assert.Equal(t, http.StatusUnauthorized, post("/api/auth/refresh", fmt.Sprintf(`{"refreshToken": %q}`, refreshed.AccessToken), "").Code,
+		"access tokens must not be refreshable")
+
+	rec = post("/api/auth/logout", fmt.Sprintf(`{"refreshToken": %q}`, refreshed.RefreshToken), refreshed.AccessToken)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, getLists(refreshed.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, post("/api/auth/refresh", fmt.Sprintf(`{"refreshToken": %q}`, refreshed.RefreshToken), "").Code)
+
+	// Basic auth keeps working for scripts
+	req := httptest.NewRequest(http.MethodGet, "/api/lists", nil)
+	req.SetBasicAuth("alice", "alicepass")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
 
-	lists := []models.List{
-		{
-			ID:     1,
-			Name:   "test",
-			UserID: 1,
-		},
+func TestExpiredToken(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	e := newTestRouter(repos)
+
+	expired := api.NewTokenIssuer(testSecret, -time.Minute, time.Hour)
+	pair, err := expired.Issue(models.User{ID: 1, Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	_, err = db.Exec("INSERT INTO lists (id, name,user_id) values (?,?,?)", lists[0].ID, lists[0].Name, lists[0].UserID)
+	req := httptest.NewRequest(http.MethodGet, "/api/lists", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 
+	forged := api.NewTokenIssuer([]byte("other secret"), 15*time.Minute, time.Hour)
+	pair, err = forged.Issue(models.User{ID: 1, Username: "alice"})
 	if err != nil {
-		log.Println(err)
+		t.Fatal(err)
 	}
 
-	want := string("{}")
+	req = httptest.NewRequest(http.MethodGet, "/api/lists", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
 
-	e := echo.New()
+func TestExportTasks(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+	inbox := testdb.CreateList(t, repos, alice, "inbox")
+	testdb.CreateTask(t, repos, inbox.ID, "one")
+	work := testdb.CreateList(t, repos, alice, "work")
+	testdb.CreateTask(t, repos, work.ID, "two")
+	bobs := testdb.CreateList(t, repos, bob, "bob's")
+	testdb.CreateTask(t, repos, bobs.ID, "secret")
+
+	e := newTestRouter(repos)
+	export := func(query string) *httptest.ResponseRecorder {
+		return send(e, http.MethodGet, "/api/list/export"+query, "", "alice", "alicepass")
+	}
+
+	rec := export("")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="tasks.csv"`, rec.Header().Get("Content-Disposition"))
+		assert.Equal(t, 3, strings.Count(rec.Body.String(), "\n"), "expected a header and one row per task")
+		assert.NotContains(t, rec.Body.String(), "secret")
+	}
+
+	rec = export(fmt.Sprintf("?format=json&list=%d", work.ID))
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, `attachment; filename="tasks.json"`, rec.Header().Get("Content-Disposition"))
+		var tasks []models.ExportedTask
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tasks))
+		if assert.Len(t, tasks, 1) {
+			assert.Equal(t, "two", tasks[0].Text)
+			assert.Equal(t, "work", tasks[0].ListName)
+		}
+	}
+
+	rec = export("?format=ical")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+	}
+
+	rec = export("?format=xlsx")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, http.StatusNotFound, export(fmt.Sprintf("?list=%d", bobs.ID)).Code)
+	assert.Equal(t, http.StatusBadRequest, export("?list=abc").Code)
+}
 
-	req := httptest.NewRequest(http.MethodDelete, "/api/lists/:id", nil)
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.SetParamNames("id")
-	c.SetParamValues("1")
+func TestSearchTasks(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+	inbox := testdb.CreateList(t, repos, alice, "inbox")
+	testdb.CreateTask(t, repos, inbox.ID, "buy milk")
+	testdb.CreateTask(t, repos, inbox.ID, "call mom")
+	bobs := testdb.CreateList(t, repos, bob, "bob's")
+	testdb.CreateTask(t, repos, bobs.ID, "buy milk too")
+
+	e := newTestRouter(repos)
+	search := func(query string) *httptest.ResponseRecorder {
+		return send(e, http.MethodGet, "/api/search?"+query, "", "alice", "alicepass")
+	}
+
+	rec := search("q=milk")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var results []struct {
+			Task     map[string]interface{} `json:"task"`
+			ListID   int                    `json:"listId"`
+			ListName string                 `json:"listName"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "buy milk", results[0].Task["text"])
+			assert.Equal(t, inbox.ID, results[0].ListID)
+			assert.Equal(t, "inbox", results[0].ListName)
+		}
+	}
+
+	assert.JSONEq(t, "[]", search("q=bread").Body.String())
+	assert.Equal(t, http.StatusBadRequest, search("q=").Code)
+	assert.Equal(t, http.StatusBadRequest, search("q=milk&limit=abc").Code)
+}
+
+func TestImportTasks(t *testing.T) {
+	repos := models.NewMemoryRepositories()
+	alice := testdb.CreateUser(t, repos, "alice", "alicepass")
+	bob := testdb.CreateUser(t, repos, "bob", "bobpass")
+	inbox := testdb.CreateList(t, repos, bob, "inbox")
+	testdb.CreateTask(t, repos, inbox.ID, "one")
+	testdb.CreateTask(t, repos, inbox.ID, "two")
+
+	e := newTestRouter(repos)
+	lists := func() []models.List {
+		lists, _, err := repos.Lists.Lists(context.Background(), alice, models.PageQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lists
+	}
+	request := func(method, target, username, password, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.SetBasicAuth(username, password)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	exported := request(http.MethodGet, "/api/list/export", "bob", "bobpass", "", "").Body.String()
+
+	rec := request(http.MethodPost, "/api/import?dryRun=true", "alice", "alicepass", "text/csv", exported)
+	var report models.ImportReport
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report)) {
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 2, report.TasksCreated)
+		assert.Equal(t, []string{"inbox"}, report.ListsCreated)
+	}
+	assert.Empty(t, lists(), "a dry run must not store anything")
+
+	rec = request(http.MethodPost, "/api/import", "alice", "alicepass", "text/csv", exported)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	if imported := lists(); assert.Len(t, imported, 1) {
+		tasks, _, _ := repos.Tasks.Tasks(context.Background(), imported[0].ID, models.PageQuery{})
+		assert.Len(t, tasks, 2)
+	}
+
+	body := `[{"listName": "work", "text": "three"}, {"listName": "work", "text": ""}]`
+	rec = request(http.MethodPost, "/api/import", "alice", "alicepass", "application/json", body)
+	if assert.Equal(t, http.StatusBadRequest, rec.Code) {
+		report = models.ImportReport{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, []models.ImportError{{Row: 2, Field: "text", Message: "must not be empty"}}, report.Errors)
+		assert.Zero(t, report.TasksCreated)
+	}
+	assert.Len(t, lists(), 1, "an invalid row must reject the whole import")
+
+	rec = request(http.MethodPost, "/api/import?dryRun=true", "alice", "alicepass", "application/json", body)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		report = models.ImportReport{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, 1, report.TasksCreated)
+		assert.Len(t, report.Errors, 1)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/api/import?format=ical", "alice", "alicepass", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/api/import?dryRun=maybe", "alice", "alicepass", "text/csv", exported).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/api/import", "alice", "alicepass", "application/json", "{").Code)
+}
 
-	handler := DeleteList(db)(c)
-	got := rec.Body.String()
+type fakeWeather struct {
+	info    models.WeatherInfo
+	err     error
+	request models.WeatherRequest
+}
 
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, want, got)
-	}
+func (f *fakeWeather) CurrentWeather(ctx context.Context, request models.WeatherRequest) (models.WeatherInfo, error) {
+	f.request = request
+	return f.info, f.err
 }
 
 func TestGetWeather(t *testing.T) {
 	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	weather := &fakeWeather{info: models.WeatherInfo{FormatedTemp: "20.0 °C", Temperature: 20, Unit: "°C", Description: "clear sky", Icon: "01d", City: "Skopje"}}
+	e.GET("/api/weather", GetWeather(weather))
+
+	get := func(target string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/weather", "lat", "41.99", "lon", "21")
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.JSONEq(t, `{"formatedTemp": "20.0 °C", "temperature": 20, "unit": "°C", "description": "clear sky", "icon": "01d", "city": "Skopje"}`, rec.Body.String())
+		assert.Equal(t, models.WeatherRequest{Lat: 41.99, Lon: 21, Units: "metric"}, weather.request)
+	}
+	assert.Equal(t, http.StatusOK, get("/api/weather?lat=1&lon=2&units=imperial&lang=de").Code)
+	assert.Equal(t, models.WeatherRequest{Lat: 1, Lon: 2, Units: "imperial", Lang: "de"}, weather.request)
+	assert.Equal(t, http.StatusBadRequest, get("/api/weather?lat=1&lon=2&units=kelvin").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/weather").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/weather", "lat", "100", "lon", "21").Code)
+
+	statuses := map[error]int{
+		models.ErrWeatherNotConfigured:                                http.StatusServiceUnavailable,
+		fmt.Errorf("%w: status 500", models.ErrWeatherUnavailable):    http.StatusBadGateway,
+		fmt.Errorf("%w: deadline exceeded", models.ErrWeatherTimeout): http.StatusGatewayTimeout,
+	}
+	for err, status := range statuses {
+		weather.err = err
+		rec := get("/api/weather", "lat", "41.99", "lon", "21")
+		assert.Equal(t, status, rec.Code, err.Error())
+		assert.NotContains(t, rec.Body.String(), "status 500")
+	}
+}
+
+var testSecret = []byte("test secret")
+
+func newTestRouter(repos models.Repositories) *echo.Echo {
+	tokens := api.NewTokenIssuer(testSecret, 15*time.Minute, time.Hour)
+	weather := &fakeWeather{err: models.ErrWeatherNotConfigured}
+	return NewRouter(api.NewDependencies(repos, tokens, service.NewCredentialCache(time.Minute), weather))
+}
 
-	req := httptest.NewRequest(http.MethodDelete, "/api/lists/:id", nil)
+// send serves a request with a JSON body as username through e.
+func send(e *echo.Echo, method, target, body, username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(username, password)
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-	c.SetParamNames("lat", "lon")
-	c.SetParamValues("41.99", "21")
-
-	handler := GetWeather()(c)
-
-	if assert.NoError(t, handler) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-	}
-}
-
-func migrate(db *sql.DB) {
-	sql := `
-	CREATE TABLE IF NOT EXISTS users(
-		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		username VARCHAR NOT NULL UNIQUE,
-		password VARCHAR NOT NULL
-	);
-    CREATE TABLE IF NOT EXISTS lists(
-        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-        name VARCHAR NOT NULL,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-	CREATE TABLE IF NOT EXISTS tasks(
-		id INTEGER NOT NULL,
-		name VARCHAR NOT NULL,
-		list_id INTEGER NOT NULL,
-		completed INTEGER,
-		PRIMARY KEY (id),
-		FOREIGN KEY(list_id) REFERENCES lists(id)
-	);
-    `
-	_, err := db.Exec(sql)
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	body, err := json.Marshal(v)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
+	return string(body)
 }
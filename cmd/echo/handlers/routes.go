@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"final/cmd/api"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewRouter serves the /api routes with deps.
+func NewRouter(deps api.Dependencies) *echo.Echo {
+	router := echo.New()
+	router.HTTPErrorHandler = HTTPErrorHandler
+
+	router.POST("/api/users", CreateUser(deps.Users))
+	router.POST("/api/auth/login", Login(deps.Users, deps.Tokens))
+	router.POST("/api/auth/refresh", RefreshToken(deps.Users, deps.Tokens))
+
+	auth := router.Group("/api")
+	auth.Use(Authenticate(deps.Users, deps.Tokens))
+
+	auth.POST("/auth/logout", Logout(deps.Users, deps.Tokens))
+
+	auth.PUT("/users/me/password", ChangePassword(deps.Users))
+	auth.DELETE("/users/me", DeleteUser(deps.Users))
+
+	auth.GET("/lists/:id/tasks", GetTasks(deps.Todos))
+	auth.POST("/lists/:id/tasks", CreateTask(deps.Todos))
+	auth.GET("/tasks", DueTasks(deps.Todos))
+	auth.GET("/tasks/:id", GetTask(deps.Todos))
+	auth.PATCH("/tasks/:id", UpdateTask(deps.Todos))
+	auth.DELETE("/tasks/:id", DeleteTask(deps.Todos))
+
+	auth.GET("/lists", GetLists(deps.Todos))
+	auth.POST("/lists", CreateList(deps.Todos))
+	auth.GET("/lists/:id", GetList(deps.Todos))
+	auth.PUT("/lists/:id", UpdateList(deps.Todos))
+	auth.PATCH("/lists/:id", UpdateList(deps.Todos))
+	auth.DELETE("/lists/:id", DeleteList(deps.Todos))
+
+	auth.GET("/trash", GetTrash(deps.Todos))
+	auth.POST("/trash/lists/:id/restore", RestoreList(deps.Todos))
+	auth.POST("/trash/tasks/:id/restore", RestoreTask(deps.Todos))
+
+	auth.GET("/list/export", ExportTasks(deps.Exports))
+	auth.POST("/import", ImportTasks(deps.Exports))
+	auth.GET("/search", SearchTasks(deps.Todos))
+	auth.GET("/weather", GetWeather(deps.Weather))
+
+	return router
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"final/cmd/api"
+	"final/cmd/service"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// tokenKey is the echo.Context key holding the *api.TokenClaims of a Bearer request.
+const tokenKey = "token"
+
+// Authenticate accepts either an "Authorization: Bearer" access token or Basic
+// credentials, and stores the matching user on the context.
+func Authenticate(users service.UserService, tokens *api.TokenIssuer) echo.MiddlewareFunc {
+	basic := middleware.BasicAuth(BasicAuthValidator(users))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withBasic := basic(next)
+
+		return func(c echo.Context) error {
+			token, ok := api.BearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+			if !ok {
+				return withBasic(c)
+			}
+
+			claims, user, err := api.VerifyToken(c.Request().Context(), users, tokens, token, api.AccessToken)
+			if err != nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return err
+			}
+
+			SetUser(c, user)
+			c.Set(tokenKey, claims)
+			return next(c)
+		}
+	}
+}
+
+func Login(users service.UserService, tokens *api.TokenIssuer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request api.CredentialsRequest
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+
+		user, ok, err := users.Authenticate(c.Request().Context(), request.Username, request.Password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return api.ErrInvalidCredentials
+		}
+
+		pair, err := tokens.Issue(user)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, pair)
+	}
+}
+
+// RefreshToken trades a refresh token for a new token pair. The presented
+// refresh token is revoked, so each one can be used only once.
+func RefreshToken(users service.UserService, tokens *api.TokenIssuer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request api.RefreshRequest
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+
+		claims, user, err := api.VerifyToken(c.Request().Context(), users, tokens, request.RefreshToken, api.RefreshToken)
+		if err != nil {
+			return err
+		}
+		if err := api.RedeemToken(c.Request().Context(), users, claims); err != nil {
+			return err
+		}
+
+		pair, err := tokens.Issue(user)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, pair)
+	}
+}
+
+// Logout revokes the access token of the request and, when given, the refresh
+// token in the body.
+func Logout(users service.UserService, tokens *api.TokenIssuer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request api.RefreshRequest
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+
+		if claims, ok := c.Get(tokenKey).(*api.TokenClaims); ok {
+			if err := api.RevokeToken(c.Request().Context(), users, claims); err != nil {
+				return err
+			}
+		}
+
+		if request.RefreshToken != "" {
+			if err := api.RevokeRefreshToken(c.Request().Context(), users, tokens, request.RefreshToken, CurrentUser(c)); err != nil {
+				return err
+			}
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"final/cmd/api"
+	"final/cmd/service"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreateUser is the signup endpoint. It is registered outside the
+// authenticated /api group.
+func CreateUser(users service.UserService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request api.CredentialsRequest
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+
+		user, err := users.SignUp(c.Request().Context(), request.Username, request.Password)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, user)
+	}
+}
+
+func ChangePassword(users service.UserService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request api.PasswordChangeRequest
+		if err := c.Bind(&request); err != nil {
+			return err
+		}
+
+		err := users.ChangePassword(c.Request().Context(), CurrentUser(c), request.CurrentPassword, request.NewPassword)
+		if err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func DeleteUser(users service.UserService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		if err := users.Delete(c.Request().Context(), user); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, H{
+			"deleted": user.ID,
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Package migrations keeps the database schema in an ordered set of embedded
+// SQL files. Every file pair sql/NNNN_name.up.sql and sql/NNNN_name.down.sql is
+// one schema version; the versions applied to a database are recorded in its
+// schema_version table. PostgreSQL databases use the same versions written in
+// its dialect under sql/postgres.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//go:embed sql/*.sql sql/postgres/*.sql
+var files embed.FS
+
+// Dialect names the SQL flavour of a set of migrations.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+var directories = map[Dialect]string{
+	SQLite:   "sql",
+	Postgres: "sql/postgres",
+}
+
+// DialectOf tells the dialect of db from its driver.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*pq.Driver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Current int
+	Latest  int
+	Pending []Migration
+}
+
+const createVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version(
+	version INTEGER NOT NULL PRIMARY KEY,
+	name VARCHAR NOT NULL,
+	applied_at BIGINT NOT NULL
+);`
+
+// All returns the embedded migrations of dialect ordered by version.
+func All(dialect Dialect) ([]Migration, error) {
+	dir, ok := directories[dialect]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+	names, err := fs.Glob(files, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected a .up.sql or .down.sql suffix", base)
+		}
+
+		prefix, label, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected a NNNN_name file name", base)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", base, prefix)
+		}
+
+		body, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	all := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: missing up or down file", m.Version, m.Name)
+		}
+		all = append(all, *m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+
+	return all, nil
+}
+
+// Up applies every pending migration.
+func Up(db *sql.DB) error {
+	all, err := All(DialectOf(db))
+	if err != nil {
+		return err
+	}
+	return up(db, all)
+}
+
+// Down reverts the latest steps applied migrations.
+func Down(db *sql.DB, steps int) error {
+	all, err := All(DialectOf(db))
+	if err != nil {
+		return err
+	}
+	return down(db, all, steps)
+}
+
+// Version returns the latest applied migration, 0 for an empty database.
+func Version(db *sql.DB) (int, error) {
+	if _, err := db.Exec(createVersionTable); err != nil {
+		return 0, fmt.Errorf("create schema_version: %w", err)
+	}
+
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("query schema version: %w", err)
+	}
+	return version, nil
+}
+
+func GetStatus(db *sql.DB) (Status, error) {
+	all, err := All(DialectOf(db))
+	if err != nil {
+		return Status{}, err
+	}
+
+	current, err := Version(db)
+	if err != nil {
+		return Status{}, err
+	}
+	return newStatus(all, current), nil
+}
+
+// ReadStatus is GetStatus for health checks: it only reads schema_version
+// and fails where GetStatus would have to create it.
+func ReadStatus(ctx context.Context, db *sql.DB) (Status, error) {
+	all, err := All(DialectOf(db))
+	if err != nil {
+		return Status{}, err
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	if err != nil {
+		return Status{}, fmt.Errorf("query schema version: %w", err)
+	}
+	return newStatus(all, current), nil
+}
+
+func newStatus(all []Migration, current int) Status {
+	status := Status{Current: current}
+	for _, m := range all {
+		status.Latest = m.Version
+		if m.Version > current {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return status
+}
+
+func up(db *sql.DB, all []Migration) error {
+	current, err := Version(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		if m.Version <= current {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_version(version, name, applied_at) VALUES($1,$2,$3)", m.Version, m.Name, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migrate up to %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func down(db *sql.DB, all []Migration, steps int) error {
+	current, err := Version(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+		m := all[i]
+		if m.Version > current {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_version WHERE version = $1", m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migrate down from %04d_%s: %w", m.Version, m.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+func inTx(db *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,281 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", name).Scan(&exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func TestAll(t *testing.T) {
+	all, err := All(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Fatalf("expected migration %d at position %d, got %d", i+1, i, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Fatalf("migration %d has an empty up or down script", m.Version)
+		}
+	}
+
+	postgres, err := All(Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(postgres) != len(all) {
+		t.Fatalf("expected %d postgres migrations, got %d", len(all), len(postgres))
+	}
+	for i, m := range postgres {
+		if m.Version != all[i].Version || m.Name != all[i].Name {
+			t.Fatalf("expected postgres migration %04d_%s, got %04d_%s", all[i].Version, all[i].Name, m.Version, m.Name)
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := openDB(t)
+	all, _ := All(SQLite)
+	latest := all[len(all)-1].Version
+
+	if err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+	// running up again must be a no-op
+	if err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := GetStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Current != latest || status.Latest != latest || len(status.Pending) != 0 {
+		t.Fatalf("expected schema at version %d with nothing pending, got %+v", latest, status)
+	}
+	for _, table := range []string{"users", "lists", "tasks"} {
+		if !tableExists(t, db, table) {
+			t.Fatalf("expected table %s after migrating up", table)
+		}
+	}
+
+	if err := Down(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := Version(db); version != latest-1 {
+		t.Fatalf("expected version %d after one step down, got %d", latest-1, version)
+	}
+
+	if err := Down(db, latest); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := Version(db); version != 0 {
+		t.Fatalf("expected version 0 after migrating all the way down, got %d", version)
+	}
+	if tableExists(t, db, "users") {
+		t.Fatalf("expected users to be dropped")
+	}
+
+	status, _ = GetStatus(db)
+	if len(status.Pending) != len(all) {
+		t.Fatalf("expected %d pending migrations, got %d", len(all), len(status.Pending))
+	}
+}
+
+func TestReadStatus(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	if _, err := ReadStatus(ctx, db); err == nil {
+		t.Fatal("expected an unmigrated database to fail the status")
+	}
+	if tableExists(t, db, "schema_version") {
+		t.Fatal("expected ReadStatus not to create schema_version")
+	}
+
+	all, _ := All(SQLite)
+	if err := up(db, all[:3]); err != nil {
+		t.Fatal(err)
+	}
+	status, err := ReadStatus(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Current != 3 || status.Latest != all[len(all)-1].Version || len(status.Pending) != len(all)-3 {
+		t.Fatalf("expected schema at version 3 with the rest pending, got %+v", status)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	db := openDB(t)
+
+	broken := []Migration{
+		{Version: 1, Name: "ok", Up: "CREATE TABLE a(id INTEGER);", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "broken", Up: "CREATE TABLE b(id INTEGER); INSERT INTO nope VALUES(1);", Down: "DROP TABLE b;"},
+	}
+
+	if err := up(db, broken); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	if version, _ := Version(db); version != 1 {
+		t.Fatalf("expected to stay at version 1, got %d", version)
+	}
+	if !tableExists(t, db, "a") {
+		t.Fatalf("expected migration 1 to be applied")
+	}
+	if tableExists(t, db, "b") {
+		t.Fatalf("expected the failed migration to be rolled back")
+	}
+}
+
+func TestTimestampsAreBackfilled(t *testing.T) {
+	db := openDB(t)
+	all, _ := All(SQLite)
+
+	if err := up(db, all[:2]); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("INSERT INTO lists(name, user_id) VALUES('old', 1)")
+	db.Exec("INSERT INTO tasks(name, list_id, completed) VALUES('done', 1, 1), ('open', 1, 0)")
+
+	if err := up(db, all[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	var missing int
+	db.QueryRow("SELECT COUNT(*) FROM tasks WHERE created_at IS NULL OR updated_at IS NULL").Scan(&missing)
+	if missing != 0 {
+		t.Fatalf("expected every task to get timestamps, %d did not", missing)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM lists WHERE created_at IS NULL OR updated_at IS NULL").Scan(&missing)
+	if missing != 0 {
+		t.Fatalf("expected every list to get timestamps, %d did not", missing)
+	}
+
+	var completed int
+	db.QueryRow("SELECT COUNT(*) FROM tasks WHERE completed_at IS NOT NULL").Scan(&completed)
+	if completed != 1 {
+		t.Fatalf("expected only the completed task to get completed_at, got %d", completed)
+	}
+}
+
+func TestTaskSearchIsBackfilled(t *testing.T) {
+	db := openDB(t)
+	all, _ := All(SQLite)
+
+	if err := up(db, all[:3]); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("INSERT INTO tasks(name, list_id, completed) VALUES('old task', 1, 0)")
+
+	if err := up(db, all[:4]); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("INSERT INTO tasks(name, list_id, completed) VALUES('new task', 1, 0)")
+
+	var found int
+	db.QueryRow("SELECT COUNT(*) FROM task_search WHERE task_search MATCH 'task'").Scan(&found)
+	if found != 2 {
+		t.Fatalf("expected both tasks to be searchable, got %d", found)
+	}
+}
+
+func TestDeletesCascade(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	all, _ := All(SQLite)
+
+	if err := up(db, all[:4]); err != nil {
+		t.Fatal(err)
+	}
+	// rows written before foreign keys were enforced may point nowhere
+	db.Exec("PRAGMA foreign_keys = OFF")
+	db.Exec("INSERT INTO users(id, username, password) VALUES(1, 'alice', 'x')")
+	db.Exec("INSERT INTO lists(id, name, user_id) VALUES(1, 'mine', 1), (2, 'orphan', 42)")
+	db.Exec("INSERT INTO tasks(id, name, list_id, completed) VALUES(1, 'kept task', 1, 0), (2, 'orphan task', 2, 0), (3, 'lost task', 42, 0)")
+	db.Exec("PRAGMA foreign_keys = ON")
+
+	if err := up(db, all[:5]); err != nil {
+		t.Fatal(err)
+	}
+
+	var lists, tasks, found int
+	db.QueryRow("SELECT COUNT(*) FROM lists").Scan(&lists)
+	db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&tasks)
+	if lists != 1 || tasks != 1 {
+		t.Fatalf("expected only the reachable list and task to be kept, got %d lists and %d tasks", lists, tasks)
+	}
+	db.Exec("INSERT INTO tasks(name, list_id, completed) VALUES('new task', 1, 0)")
+	db.QueryRow("SELECT COUNT(*) FROM task_search WHERE task_search MATCH 'task'").Scan(&found)
+	if found != 2 {
+		t.Fatalf("expected search to cover the kept and the new task, got %d", found)
+	}
+	if _, err := db.Exec("INSERT INTO tasks(name, list_id, completed) VALUES('nowhere', 42, 0)"); err == nil {
+		t.Fatal("expected a task of a missing list to be rejected")
+	}
+
+	if _, err := db.Exec("DELETE FROM users WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&tasks)
+	db.QueryRow("SELECT COUNT(*) FROM task_search").Scan(&found)
+	if tasks != 0 || found != 0 {
+		t.Fatalf("expected the user's tasks and their index entries to go with the user, got %d and %d", tasks, found)
+	}
+
+	if err := Down(db, 1); err != nil {
+		t.Fatalf("expected 0005 to revert with foreign keys on, got %v", err)
+	}
+}
+
+func TestTrashIsEmptiedOnDown(t *testing.T) {
+	db := openDB(t)
+	all, _ := All(SQLite)
+	if err := up(db, all[:6]); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("INSERT INTO users(id, username, password) VALUES(1, 'alice', 'x')")
+	db.Exec("INSERT INTO lists(id, name, user_id, deleted_at) VALUES(1, 'kept', 1, NULL), (2, 'trashed', 1, CURRENT_TIMESTAMP)")
+	db.Exec("INSERT INTO tasks(id, name, list_id, completed, deleted_at) VALUES(1, 'kept task', 1, 0, NULL), (2, 'trashed task', 1, 0, CURRENT_TIMESTAMP), (3, 'task of a trashed list', 2, 0, NULL)")
+
+	if err := Down(db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var lists, tasks, found int
+	db.QueryRow("SELECT COUNT(*) FROM lists").Scan(&lists)
+	db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&tasks)
+	db.QueryRow("SELECT COUNT(*) FROM task_search").Scan(&found)
+	if lists != 1 || tasks != 1 || found != 1 {
+		t.Fatalf("expected only the list and task outside the trash to be kept, got %d lists, %d tasks and %d index entries", lists, tasks, found)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE tasks;
+DROP TABLE lists;
+DROP TABLE users;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS users(
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	username VARCHAR NOT NULL UNIQUE,
+	password VARCHAR NOT NULL
+);
+CREATE TABLE IF NOT EXISTS lists(
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR NOT NULL,
+	user_id INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE TABLE IF NOT EXISTS tasks(
+	id INTEGER NOT NULL,
+	name VARCHAR NOT NULL,
+	list_id INTEGER NOT NULL,
+	completed INTEGER,
+	PRIMARY KEY (id),
+	FOREIGN KEY(list_id) REFERENCES lists(id)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE lists ADD COLUMN created_at DATETIME;
+ALTER TABLE lists ADD COLUMN updated_at DATETIME;
+ALTER TABLE tasks ADD COLUMN created_at DATETIME;
+ALTER TABLE tasks ADD COLUMN updated_at DATETIME;
+ALTER TABLE tasks ADD COLUMN completed_at DATETIME;
+
+UPDATE lists SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+UPDATE tasks SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+UPDATE tasks SET completed_at = CURRENT_TIMESTAMP WHERE completed;
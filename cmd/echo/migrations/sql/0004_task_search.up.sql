@@ -0,0 +1,18 @@
+-- task_search indexes task names by task id. The triggers keep it in sync with
+-- every write to tasks, so CreateTask, UpdateTask, DeleteTask, imports and
+-- cascading deletes need no extra statements.
+CREATE VIRTUAL TABLE task_search USING fts5(name, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO task_search(rowid, name) SELECT id, name FROM tasks;
+
+CREATE TRIGGER task_search_insert AFTER INSERT ON tasks BEGIN
+	INSERT INTO task_search(rowid, name) VALUES (new.id, new.name);
+END;
+
+CREATE TRIGGER task_search_update AFTER UPDATE OF name ON tasks BEGIN
+	UPDATE task_search SET name = new.name WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER task_search_delete AFTER DELETE ON tasks BEGIN
+	DELETE FROM task_search WHERE rowid = old.id;
+END;
@@ -0,0 +1,41 @@
+CREATE TABLE lists_old(
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR NOT NULL,
+	user_id INTEGER,
+	created_at DATETIME,
+	updated_at DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+INSERT INTO lists_old(id, name, user_id, created_at, updated_at)
+	SELECT id, name, user_id, created_at, updated_at FROM lists;
+
+CREATE TABLE tasks_old(
+	id INTEGER NOT NULL,
+	name VARCHAR NOT NULL,
+	list_id INTEGER NOT NULL,
+	completed INTEGER,
+	created_at DATETIME,
+	updated_at DATETIME,
+	completed_at DATETIME,
+	PRIMARY KEY (id),
+	FOREIGN KEY(list_id) REFERENCES lists_old(id)
+);
+INSERT INTO tasks_old(id, name, list_id, completed, created_at, updated_at, completed_at)
+	SELECT id, name, list_id, completed, created_at, updated_at, completed_at FROM tasks;
+
+DROP TABLE tasks;
+DROP TABLE lists;
+ALTER TABLE lists_old RENAME TO lists;
+ALTER TABLE tasks_old RENAME TO tasks;
+
+CREATE TRIGGER task_search_insert AFTER INSERT ON tasks BEGIN
+	INSERT INTO task_search(rowid, name) VALUES (new.id, new.name);
+END;
+
+CREATE TRIGGER task_search_update AFTER UPDATE OF name ON tasks BEGIN
+	UPDATE task_search SET name = new.name WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER task_search_delete AFTER DELETE ON tasks BEGIN
+	DELETE FROM task_search WHERE rowid = old.id;
+END;
@@ -0,0 +1,50 @@
+-- SQLite cannot change the constraints of a table, so lists and tasks are
+-- rebuilt with ON DELETE CASCADE. The copies are created under new names and
+-- renamed, which also rewrites the references to them. Lists of missing users
+-- and tasks of missing lists, left over from before foreign keys were
+-- enforced, cannot be reached by anyone and are not copied.
+CREATE TABLE lists_new(
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR NOT NULL,
+	user_id INTEGER,
+	created_at DATETIME,
+	updated_at DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO lists_new(id, name, user_id, created_at, updated_at)
+	SELECT id, name, user_id, created_at, updated_at FROM lists
+	WHERE user_id IS NULL OR user_id IN (SELECT id FROM users);
+
+CREATE TABLE tasks_new(
+	id INTEGER NOT NULL,
+	name VARCHAR NOT NULL,
+	list_id INTEGER NOT NULL,
+	completed INTEGER,
+	created_at DATETIME,
+	updated_at DATETIME,
+	completed_at DATETIME,
+	PRIMARY KEY (id),
+	FOREIGN KEY(list_id) REFERENCES lists_new(id) ON DELETE CASCADE
+);
+INSERT INTO tasks_new(id, name, list_id, completed, created_at, updated_at, completed_at)
+	SELECT id, name, list_id, completed, created_at, updated_at, completed_at FROM tasks
+	WHERE list_id IN (SELECT id FROM lists_new);
+DELETE FROM task_search WHERE rowid NOT IN (SELECT id FROM tasks_new);
+
+-- dropping tasks drops the task_search triggers as well
+DROP TABLE tasks;
+DROP TABLE lists;
+ALTER TABLE lists_new RENAME TO lists;
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE TRIGGER task_search_insert AFTER INSERT ON tasks BEGIN
+	INSERT INTO task_search(rowid, name) VALUES (new.id, new.name);
+END;
+
+CREATE TRIGGER task_search_update AFTER UPDATE OF name ON tasks BEGIN
+	UPDATE task_search SET name = new.name WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER task_search_delete AFTER DELETE ON tasks BEGIN
+	DELETE FROM task_search WHERE rowid = old.id;
+END;
@@ -0,0 +1,5 @@
+DROP INDEX tasks_remind_at;
+DROP INDEX tasks_due_at;
+ALTER TABLE tasks DROP COLUMN reminded_at;
+ALTER TABLE tasks DROP COLUMN remind_at;
+ALTER TABLE tasks DROP COLUMN due_at;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS users(
+	id SERIAL PRIMARY KEY,
+	username VARCHAR NOT NULL UNIQUE,
+	password VARCHAR NOT NULL
+);
+CREATE TABLE IF NOT EXISTS lists(
+	id SERIAL PRIMARY KEY,
+	name VARCHAR NOT NULL,
+	user_id INTEGER REFERENCES users(id)
+);
+CREATE TABLE IF NOT EXISTS tasks(
+	id SERIAL PRIMARY KEY,
+	name VARCHAR NOT NULL,
+	list_id INTEGER NOT NULL REFERENCES lists(id),
+	completed BOOLEAN NOT NULL DEFAULT FALSE
+);
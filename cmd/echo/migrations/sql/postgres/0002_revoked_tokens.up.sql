@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens(
+	jti VARCHAR NOT NULL PRIMARY KEY,
+	expires_at BIGINT NOT NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE tasks DROP COLUMN completed_at;
+ALTER TABLE tasks DROP COLUMN updated_at;
+ALTER TABLE tasks DROP COLUMN created_at;
+ALTER TABLE lists DROP COLUMN updated_at;
+ALTER TABLE lists DROP COLUMN created_at;
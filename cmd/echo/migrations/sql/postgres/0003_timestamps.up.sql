@@ -0,0 +1,11 @@
+-- timestamps hold UTC without a zone, like the SQLite schema, so that their
+-- text form sorts chronologically for cursor pagination
+ALTER TABLE lists ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE lists ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN completed_at TIMESTAMP;
+
+UPDATE lists SET created_at = now() AT TIME ZONE 'UTC', updated_at = now() AT TIME ZONE 'UTC';
+UPDATE tasks SET created_at = now() AT TIME ZONE 'UTC', updated_at = now() AT TIME ZONE 'UTC';
+UPDATE tasks SET completed_at = now() AT TIME ZONE 'UTC' WHERE completed;
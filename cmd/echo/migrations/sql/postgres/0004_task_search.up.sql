@@ -0,0 +1,5 @@
+-- search is the text search vector of the task name. As a generated column it
+-- follows every write to tasks without triggers.
+ALTER TABLE tasks ADD COLUMN search tsvector GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED;
+
+CREATE INDEX tasks_search ON tasks USING GIN (search);
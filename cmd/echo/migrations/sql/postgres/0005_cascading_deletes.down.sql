@@ -0,0 +1,6 @@
+ALTER TABLE lists
+	DROP CONSTRAINT lists_user_id_fkey,
+	ADD CONSTRAINT lists_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE tasks
+	DROP CONSTRAINT tasks_list_id_fkey,
+	ADD CONSTRAINT tasks_list_id_fkey FOREIGN KEY (list_id) REFERENCES lists(id);
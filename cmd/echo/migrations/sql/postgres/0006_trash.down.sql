@@ -0,0 +1,8 @@
+-- without deleted_at the trash would come back, so it is emptied first
+DELETE FROM tasks WHERE deleted_at IS NOT NULL OR list_id IN (SELECT id FROM lists WHERE deleted_at IS NOT NULL);
+DELETE FROM lists WHERE deleted_at IS NOT NULL;
+
+DROP INDEX tasks_deleted_at;
+DROP INDEX lists_deleted_at;
+ALTER TABLE tasks DROP COLUMN deleted_at;
+ALTER TABLE lists DROP COLUMN deleted_at;
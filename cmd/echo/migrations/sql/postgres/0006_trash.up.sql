@@ -0,0 +1,7 @@
+-- deleted_at is set when a list or task is moved to the trash. Trashed rows
+-- are left out of everything but the trash until they are restored or purged.
+ALTER TABLE lists ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX lists_deleted_at ON lists(deleted_at);
+CREATE INDEX tasks_deleted_at ON tasks(deleted_at);
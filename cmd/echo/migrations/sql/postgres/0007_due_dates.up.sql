@@ -0,0 +1,8 @@
+-- due_at and remind_at are optional. reminded_at is when the reminder for
+-- remind_at went out, so that it is sent once; changing remind_at clears it.
+ALTER TABLE tasks ADD COLUMN due_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN remind_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN reminded_at TIMESTAMP;
+
+CREATE INDEX tasks_due_at ON tasks(due_at);
+CREATE INDEX tasks_remind_at ON tasks(remind_at);
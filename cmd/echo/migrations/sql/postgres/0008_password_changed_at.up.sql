@@ -0,0 +1,3 @@
+-- password_changed_at invalidates the tokens issued before it; NULL means
+-- the password was never changed.
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP;
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	DueToday   = "today"
+	DueOverdue = "overdue"
+	DueWeek    = "week"
+)
+
+// DueQuery selects the tasks of a user by due date, across all of their
+// lists. Days start at midnight in Location, UTC when it is nil.
+type DueQuery struct {
+	// Due is DueToday, DueOverdue or DueWeek, the next seven days from today.
+	Due       string
+	Location  *time.Location
+	Completed *bool
+}
+
+// dueWindow is the range [from, to) the due time of a task has to fall in.
+type dueWindow struct {
+	from, to  time.Time
+	completed *bool
+}
+
+func (q DueQuery) window(at time.Time) (dueWindow, error) {
+	location := q.Location
+	if location == nil {
+		location = time.UTC
+	}
+	local := at.In(location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+
+	switch q.Due {
+	case DueToday:
+		return dueWindow{today.UTC(), today.AddDate(0, 0, 1).UTC(), q.Completed}, nil
+	case DueWeek:
+		return dueWindow{today.UTC(), today.AddDate(0, 0, 7).UTC(), q.Completed}, nil
+	case DueOverdue:
+		// a completed task is never overdue
+		if q.Completed != nil && *q.Completed {
+			return dueWindow{}, &ValidationError{Field: "completed", Message: "must be false for overdue tasks"}
+		}
+		incomplete := false
+		return dueWindow{time.Time{}, at.UTC(), &incomplete}, nil
+	}
+	return dueWindow{}, &ValidationError{Field: "due", Message: fmt.Sprintf("must be %s, %s or %s", DueToday, DueOverdue, DueWeek)}
+}
+
+func (w dueWindow) contains(task Task) bool {
+	if task.DueAt == nil || task.DueAt.Before(w.from) || !task.DueAt.Before(w.to) {
+		return false
+	}
+	return w.completed == nil || task.Completed == *w.completed
+}
+
+// DueTasks returns the tasks of user due in the window of q, soonest first.
+func DueTasks(ctx context.Context, db *sql.DB, user User, q DueQuery) ([]Task, error) {
+	w, err := q.window(now())
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + taskColumns + ` FROM tasks
+		WHERE due_at >= $1 AND due_at < $2 AND deleted_at IS NULL
+		AND list_id IN (SELECT id FROM lists WHERE user_id = $3 AND deleted_at IS NULL)`
+	args := []interface{}{w.from, w.to, user.ID}
+	if w.completed != nil {
+		query += " AND completed = $4"
+		args = append(args, *w.completed)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY due_at, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("query due tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query due tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// Reminder is a task whose reminder time has come, with whom to remind.
+type Reminder struct {
+	Task     Task   `json:"task"`
+	ListName string `json:"listName"`
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+}
+
+// DueReminders returns the reminders due by until that have not been sent,
+// earliest first. Completed and trashed tasks are not reminded of.
+func DueReminders(ctx context.Context, db *sql.DB, until time.Time) ([]Reminder, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+qualifiedTaskColumns+`, l.name, u.id, u.username
+		FROM tasks AS t
+		JOIN lists AS l ON l.id = t.list_id
+		JOIN users AS u ON u.id = l.user_id
+		WHERE t.remind_at <= $1 AND t.reminded_at IS NULL AND t.completed = $2
+		AND t.deleted_at IS NULL AND l.deleted_at IS NULL
+		ORDER BY t.remind_at, t.id`, until.UTC(), false)
+	if err != nil {
+		return nil, fmt.Errorf("query reminders: %w", err)
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		reminder := Reminder{}
+		task, err := scanTask(extraScanner{rows, []interface{}{&reminder.ListName, &reminder.UserID, &reminder.Username}})
+		if err != nil {
+			return nil, fmt.Errorf("scan reminder: %w", err)
+		}
+		reminder.Task = task
+		reminders = append(reminders, reminder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query reminders: %w", err)
+	}
+	return reminders, nil
+}
+
+// MarkReminded records that the reminder of a task went out, so that it is
+// not sent again until its reminder time changes.
+func MarkReminded(ctx context.Context, db *sql.DB, id int) error {
+	result, err := db.ExecContext(ctx, "UPDATE tasks SET reminded_at = $1 WHERE id = $2", now(), id)
+	if err != nil {
+		return fmt.Errorf("mark task %d reminded: %w", id, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("mark task %d reminded: %w", id, err)
+	}
+	if affected == 0 {
+		return notFound("task", id)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// ValidationError reports a rejected input value. Handlers turn it into a 400.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func notFound(what string, id int) error {
+	return fmt.Errorf("%s %d %w", what, id, ErrNotFound)
+}
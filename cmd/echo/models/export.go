@@ -0,0 +1,314 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ExportedTask is one task as written by every export format.
+type ExportedTask struct {
+	ID          int        `json:"id"`
+	ListID      int        `json:"listId"`
+	ListName    string     `json:"listName"`
+	Text        string     `json:"text"`
+	Completed   bool       `json:"completed"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	DueAt       *time.Time `json:"dueAt"`
+}
+
+type ExportFormat struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newEncoder  func(w io.Writer) taskEncoder
+}
+
+type taskEncoder interface {
+	Begin() error
+	Encode(task ExportedTask) error
+	End() error
+}
+
+var exportFormats = []ExportFormat{
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", newEncoder: newCSVEncoder},
+	{Name: "json", ContentType: "application/json; charset=utf-8", Extension: "json", newEncoder: newJSONEncoder},
+	{Name: "markdown", ContentType: "text/markdown; charset=utf-8", Extension: "md", newEncoder: newMarkdownEncoder},
+	{Name: "ical", ContentType: "text/calendar; charset=utf-8", Extension: "ics", newEncoder: newICalEncoder},
+}
+
+// LookupExportFormat finds a format by name or file extension, e.g. "md" or "ics".
+func LookupExportFormat(name string) (ExportFormat, error) {
+	name = strings.ToLower(name)
+	for _, format := range exportFormats {
+		if format.Name == name || format.Extension == name {
+			return format, nil
+		}
+	}
+	return ExportFormat{}, &ValidationError{Field: "format", Message: "must be one of csv, json, markdown or ical"}
+}
+
+// ExportTasks streams the tasks of user to w, one list after another. A listID
+// other than 0 restricts the export to that list.
+func ExportTasks(ctx context.Context, db *sql.DB, w io.Writer, format ExportFormat, user User, listID int) error {
+	query := `SELECT t.id, t.list_id, l.name, t.name, t.completed, t.created_at, t.updated_at, t.completed_at, t.due_at
+		FROM tasks AS t JOIN lists AS l ON l.id = t.list_id
+		WHERE l.user_id = $1 AND ($2 = 0 OR l.id = $2) AND t.deleted_at IS NULL AND l.deleted_at IS NULL
+		ORDER BY l.id, t.id`
+	rows, err := db.QueryContext(ctx, query, user.ID, listID)
+
+	if err != nil {
+		return fmt.Errorf("query tasks: %w", err)
+	}
+
+	defer rows.Close()
+
+	encoder := format.newEncoder(w)
+	if err := encoder.Begin(); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		task := ExportedTask{}
+		var createdAt, updatedAt, completedAt, dueAt sql.NullTime
+		err := rows.Scan(&task.ID, &task.ListID, &task.ListName, &task.Text, &task.Completed, &createdAt, &updatedAt, &completedAt, &dueAt)
+
+		if err != nil {
+			return fmt.Errorf("scan task: %w", err)
+		}
+		task.CreatedAt = createdAt.Time.UTC()
+		task.UpdatedAt = updatedAt.Time.UTC()
+		task.CompletedAt = nullTime(completedAt)
+		task.DueAt = nullTime(dueAt)
+
+		if err := encoder.Encode(task); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query tasks: %w", err)
+	}
+
+	return encoder.End()
+}
+
+func ExportTasksCSV(ctx context.Context, db *sql.DB, w io.Writer, user User, listID int) error {
+	format, _ := LookupExportFormat("csv")
+	return ExportTasks(ctx, db, w, format, user, listID)
+}
+
+// CSVHeader is the first row of a CSV export.
+var CSVHeader = []string{"id", "list_id", "list", "text", "completed", "created_at", "updated_at", "completed_at", "due_at"}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) taskEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write(CSVHeader)
+}
+
+func (e *csvEncoder) Encode(task ExportedTask) error {
+	return e.w.Write([]string{
+		strconv.Itoa(task.ID),
+		strconv.Itoa(task.ListID),
+		task.ListName,
+		task.Text,
+		strconv.FormatBool(task.Completed),
+		formatTime(&task.CreatedAt),
+		formatTime(&task.UpdatedAt),
+		formatTime(task.CompletedAt),
+		formatTime(task.DueAt),
+	})
+}
+
+func (e *csvEncoder) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// jsonEncoder writes a JSON array one element at a time.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONEncoder(w io.Writer) taskEncoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonEncoder) Encode(task ExportedTask) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(body)
+	return err
+}
+
+func (e *jsonEncoder) End() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+// markdownEncoder writes a checklist per list. It relies on the export being
+// ordered by list.
+type markdownEncoder struct {
+	w      io.Writer
+	listID int
+}
+
+func newMarkdownEncoder(w io.Writer) taskEncoder {
+	return &markdownEncoder{w: w}
+}
+
+func (e *markdownEncoder) Begin() error {
+	return nil
+}
+
+func (e *markdownEncoder) Encode(task ExportedTask) error {
+	if task.ListID != e.listID {
+		separator := "\n"
+		if e.listID == 0 {
+			separator = ""
+		}
+		if _, err := fmt.Fprintf(e.w, "%s## %s\n\n", separator, markdownLine(task.ListName)); err != nil {
+			return err
+		}
+		e.listID = task.ListID
+	}
+
+	box := " "
+	if task.Completed {
+		box = "x"
+	}
+	due := ""
+	if task.DueAt != nil {
+		due = " (due " + formatTime(task.DueAt) + ")"
+	}
+	_, err := fmt.Fprintf(e.w, "- [%s] %s%s\n", box, markdownLine(task.Text), due)
+	return err
+}
+
+func (e *markdownEncoder) End() error {
+	return nil
+}
+
+func markdownLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// icalEncoder writes an RFC 5545 calendar with one VTODO per task.
+type icalEncoder struct {
+	w     io.Writer
+	stamp time.Time
+}
+
+func newICalEncoder(w io.Writer) taskEncoder {
+	return &icalEncoder{w: w, stamp: now()}
+}
+
+func (e *icalEncoder) Begin() error {
+	return e.lines(
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//ScaleFocus GO Accademy//To Do//EN",
+	)
+}
+
+func (e *icalEncoder) Encode(task ExportedTask) error {
+	status := "NEEDS-ACTION"
+	if task.Completed {
+		status = "COMPLETED"
+	}
+
+	lines := []string{
+		"BEGIN:VTODO",
+		fmt.Sprintf("UID:task-%d@final", task.ID),
+		"DTSTAMP:" + icalTime(e.stamp),
+		"SUMMARY:" + icalText(task.Text),
+		"CATEGORIES:" + icalText(task.ListName),
+		"STATUS:" + status,
+	}
+	if !task.CreatedAt.IsZero() {
+		lines = append(lines, "CREATED:"+icalTime(task.CreatedAt))
+	}
+	if !task.UpdatedAt.IsZero() {
+		lines = append(lines, "LAST-MODIFIED:"+icalTime(task.UpdatedAt))
+	}
+	if task.DueAt != nil {
+		lines = append(lines, "DUE:"+icalTime(*task.DueAt))
+	}
+	if task.CompletedAt != nil {
+		lines = append(lines, "COMPLETED:"+icalTime(*task.CompletedAt))
+	}
+	lines = append(lines, "END:VTODO")
+
+	return e.lines(lines...)
+}
+
+func (e *icalEncoder) End() error {
+	return e.lines("END:VCALENDAR")
+}
+
+// lines writes content lines with CRLF endings, folded at 75 octets.
+func (e *icalEncoder) lines(lines ...string) error {
+	for _, line := range lines {
+		for len(line) > 75 {
+			cut := 75
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if _, err := io.WriteString(e.w, line[:cut]+"\r\n"); err != nil {
+				return err
+			}
+			line = " " + line[cut:]
+		}
+		if _, err := io.WriteString(e.w, line+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icalText(s string) string {
+	return icalEscaper.Replace(s)
+}
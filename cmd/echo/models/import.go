@@ -0,0 +1,240 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ImportRow is a task read from an import file. Row counts data rows from 1.
+type ImportRow struct {
+	Row         int
+	ListName    string
+	Text        string
+	Completed   bool
+	CreatedAt   *time.Time
+	CompletedAt *time.Time
+	DueAt       *time.Time
+}
+
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun       bool          `json:"dryRun"`
+	ListsCreated []string      `json:"listsCreated"`
+	ListsReused  []string      `json:"listsReused"`
+	TasksCreated int           `json:"tasksCreated"`
+	Errors       []ImportError `json:"errors"`
+}
+
+// ParseImport reads rows in one of the export formats. Malformed documents
+// fail as a whole; invalid values are reported per row.
+func ParseImport(r io.Reader, format ExportFormat) ([]ImportRow, []ImportError, error) {
+	switch format.Name {
+	case "csv":
+		return parseCSVImport(r)
+	case "json":
+		return parseJSONImport(r)
+	default:
+		return nil, nil, &ValidationError{Field: "format", Message: "only csv and json can be imported"}
+	}
+}
+
+func parseCSVImport(r io.Reader) ([]ImportRow, []ImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, &ValidationError{Field: "body", Message: err.Error()}
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"list", "text"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, &ValidationError{Field: "body", Message: fmt.Sprintf("missing %q column", required)}
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []ImportRow
+	var problems []ImportError
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, &ValidationError{Field: "body", Message: err.Error()}
+		}
+
+		row := ImportRow{Row: n, ListName: field(record, "list"), Text: field(record, "text")}
+		rowProblems := []ImportError{}
+
+		if completed := field(record, "completed"); completed != "" {
+			row.Completed, err = strconv.ParseBool(completed)
+			if err != nil {
+				rowProblems = append(rowProblems, ImportError{Row: n, Field: "completed", Message: "must be true or false"})
+			}
+		}
+		if row.CreatedAt, err = parseImportTime(field(record, "created_at")); err != nil {
+			rowProblems = append(rowProblems, ImportError{Row: n, Field: "created_at", Message: "must be an RFC 3339 time"})
+		}
+		if row.CompletedAt, err = parseImportTime(field(record, "completed_at")); err != nil {
+			rowProblems = append(rowProblems, ImportError{Row: n, Field: "completed_at", Message: "must be an RFC 3339 time"})
+		}
+		if row.DueAt, err = parseImportTime(field(record, "due_at")); err != nil {
+			rowProblems = append(rowProblems, ImportError{Row: n, Field: "due_at", Message: "must be an RFC 3339 time"})
+		}
+
+		rowProblems = append(rowProblems, validateImportRow(row)...)
+		if len(rowProblems) > 0 {
+			problems = append(problems, rowProblems...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, problems, nil
+}
+
+func parseImportTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func parseJSONImport(r io.Reader) ([]ImportRow, []ImportError, error) {
+	var tasks []ExportedTask
+	if err := json.NewDecoder(r).Decode(&tasks); err != nil {
+		return nil, nil, &ValidationError{Field: "body", Message: err.Error()}
+	}
+
+	var rows []ImportRow
+	var problems []ImportError
+	for i, task := range tasks {
+		row := ImportRow{
+			Row:         i + 1,
+			ListName:    strings.TrimSpace(task.ListName),
+			Text:        strings.TrimSpace(task.Text),
+			Completed:   task.Completed,
+			CompletedAt: utcTime(task.CompletedAt),
+			DueAt:       utcTime(task.DueAt),
+		}
+		if !task.CreatedAt.IsZero() {
+			createdAt := task.CreatedAt.UTC()
+			row.CreatedAt = &createdAt
+		}
+
+		if rowProblems := validateImportRow(row); len(rowProblems) > 0 {
+			problems = append(problems, rowProblems...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, problems, nil
+}
+
+func validateImportRow(row ImportRow) []ImportError {
+	var problems []ImportError
+	if row.ListName == "" {
+		problems = append(problems, ImportError{Row: row.Row, Field: "list", Message: "must not be empty"})
+	} else if utf8.RuneCountInString(row.ListName) > MaxListNameLength {
+		problems = append(problems, ImportError{Row: row.Row, Field: "list", Message: fmt.Sprintf("must be at most %d characters long", MaxListNameLength)})
+	}
+	if row.Text == "" {
+		problems = append(problems, ImportError{Row: row.Row, Field: "text", Message: "must not be empty"})
+	}
+	return problems
+}
+
+// ImportTasks adds rows to the lists of user, creating lists that do not exist
+// yet by name. Everything happens in one transaction, which a dry run rolls
+// back after filling in the report.
+func ImportTasks(ctx context.Context, db *sql.DB, user User, rows []ImportRow, dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, ListsCreated: []string{}, ListsReused: []string{}, Errors: []ImportError{}}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, fmt.Errorf("import: %w", err)
+	}
+	defer tx.Rollback()
+
+	importedAt := now()
+	listIDs := map[string]int64{}
+	for _, row := range rows {
+		listID, ok := listIDs[row.ListName]
+		if !ok {
+			err := tx.QueryRowContext(ctx, "SELECT id FROM lists WHERE user_id = $1 AND name = $2 AND deleted_at IS NULL", user.ID, row.ListName).Scan(&listID)
+			switch {
+			case err == nil:
+				report.ListsReused = append(report.ListsReused, row.ListName)
+			case errors.Is(err, sql.ErrNoRows):
+				err := tx.QueryRowContext(ctx, "INSERT INTO lists(name, user_id, created_at, updated_at) VALUES($1,$2,$3,$3) RETURNING id", row.ListName, user.ID, importedAt).Scan(&listID)
+				if err != nil {
+					return report, fmt.Errorf("import list %q: %w", row.ListName, err)
+				}
+				report.ListsCreated = append(report.ListsCreated, row.ListName)
+			default:
+				return report, fmt.Errorf("import list %q: %w", row.ListName, err)
+			}
+			listIDs[row.ListName] = listID
+		}
+
+		createdAt := importedAt
+		if row.CreatedAt != nil {
+			createdAt = *row.CreatedAt
+		}
+		var completedAt *time.Time
+		if row.Completed {
+			completedAt = row.CompletedAt
+			if completedAt == nil {
+				completedAt = &importedAt
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO tasks(name, list_id, completed, created_at, updated_at, completed_at, due_at) VALUES($1,$2,$3,$4,$5,$6,$7)",
+			row.Text, listID, row.Completed, createdAt, importedAt, completedAt, row.DueAt)
+		if err != nil {
+			return report, fmt.Errorf("import row %d: %w", row.Row, err)
+		}
+		report.TasksCreated++
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("import: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,905 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// NewMemoryRepositories keeps everything in the memory of the process, so
+// nothing survives a restart. It behaves like the SQL repositories and backs
+// the handler tests and the -store=memory demo mode.
+func NewMemoryRepositories() Repositories {
+	s := &memoryStore{
+		users:    map[int]User{},
+		lists:    map[int]List{},
+		tasks:    map[int]Task{},
+		revoked:  map[string]time.Time{},
+		reminded: map[int]bool{},
+	}
+	return Repositories{Lists: memoryLists{s}, Tasks: memoryTasks{s}, Users: memoryUsers{s}}
+}
+
+// memoryStore holds the rows of every table. One mutex guards all of them,
+// which keeps multi-row changes such as deleting a user atomic. Tasks have to
+// be in an existing list, like the foreign key of the SQL schema demands.
+// Trashed lists and tasks stay in the maps with DeletedAt set.
+type memoryStore struct {
+	mu      sync.Mutex
+	users   map[int]User
+	lists   map[int]List
+	tasks   map[int]Task
+	revoked map[string]time.Time
+	// reminded holds the tasks whose reminder went out, like reminded_at
+	reminded map[int]bool
+
+	// ids are never reused, like AUTOINCREMENT and SERIAL columns
+	lastUserID, lastListID, lastTaskID int
+}
+
+// lock takes the mutex unless ctx is done already, in which case it fails
+// like a query on a cancelled context does.
+func (s *memoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	return nil
+}
+
+func (s *memoryStore) insertList(user User, name string, createdAt time.Time) List {
+	s.lastListID++
+	list := List{ID: s.lastListID, Name: name, UserID: user.ID, CreatedAt: createdAt, UpdatedAt: createdAt}
+	s.lists[list.ID] = list
+	return list
+}
+
+func (s *memoryStore) insertTask(task Task) Task {
+	s.lastTaskID++
+	task.ID = s.lastTaskID
+	s.tasks[task.ID] = task
+	return task
+}
+
+// listNamed finds the list of userID called name outside the trash, skipping
+// the list except.
+func (s *memoryStore) listNamed(userID int, name string, except int) (List, bool) {
+	for _, list := range s.lists {
+		if list.UserID == userID && list.Name == name && list.ID != except && list.DeletedAt == nil {
+			return list, true
+		}
+	}
+	return List{}, false
+}
+
+func (s *memoryStore) liveList(id int) (List, bool) {
+	list, ok := s.lists[id]
+	return list, ok && list.DeletedAt == nil
+}
+
+func (s *memoryStore) liveTask(id int) (Task, bool) {
+	task, ok := s.tasks[id]
+	return task, ok && task.DeletedAt == nil
+}
+
+// visible tells whether neither task nor its list is in the trash.
+func (s *memoryStore) visible(task Task) bool {
+	_, live := s.liveList(task.ListID)
+	return live && task.DeletedAt == nil
+}
+
+func (s *memoryStore) taskOwnedBy(task Task, user User) bool {
+	list, ok := s.lists[task.ListID]
+	return ok && list.UserID == user.ID
+}
+
+// memoryRow is what a PageQuery looks at in a list or a task.
+type memoryRow struct {
+	id        int
+	name      string
+	createdAt time.Time
+	completed bool
+}
+
+// memoryTimeFormat has a fixed width so that formatted times sort like the
+// times themselves.
+const memoryTimeFormat = "2006-01-02 15:04:05.000000000"
+
+// position is where a row sorts: by value, then by id.
+type position struct {
+	value string
+	id    int
+}
+
+func (p position) before(other position) bool {
+	if p.value != other.value {
+		return p.value < other.value
+	}
+	return p.id < other.id
+}
+
+func (r memoryRow) position(column string) position {
+	switch column {
+	case "name":
+		return position{r.name, r.id}
+	case "created":
+		return position{r.createdAt.Format(memoryTimeFormat), r.id}
+	}
+	return position{id: r.id}
+}
+
+// pageRows is QueryTasks and QueryLists over rows held in memory. It returns
+// the ids of the rows on the page and the cursor of the next page.
+func (q PageQuery) pageRows(rows []memoryRow) ([]int, string, error) {
+	p, err := q.page()
+	if err != nil {
+		return nil, "", err
+	}
+	column := strings.TrimPrefix(p.sort, "-")
+	descending := strings.HasPrefix(p.sort, "-")
+
+	// page has already rejected invalid cursors
+	var after *position
+	if q.Cursor != "" {
+		c, _ := decodeCursor(q.Cursor)
+		after = &position{c.Value, c.ID}
+	}
+
+	search := strings.ToLower(q.Search)
+	var kept []memoryRow
+	for _, row := range rows {
+		if search != "" && !strings.Contains(strings.ToLower(row.name), search) {
+			continue
+		}
+		if q.Completed != nil && row.completed != *q.Completed {
+			continue
+		}
+		if after != nil {
+			at := row.position(column)
+			if descending && !at.before(*after) || !descending && !after.before(at) {
+				continue
+			}
+		}
+		kept = append(kept, row)
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		if descending {
+			return kept[j].position(column).before(kept[i].position(column))
+		}
+		return kept[i].position(column).before(kept[j].position(column))
+	})
+
+	next := ""
+	if p.limit > 0 && len(kept) > p.limit {
+		kept = kept[:p.limit]
+		last := kept[len(kept)-1].position(column)
+		next = p.next(last.id, last.value)
+	}
+
+	ids := make([]int, len(kept))
+	for i, row := range kept {
+		ids[i] = row.id
+	}
+	return ids, next, nil
+}
+
+type memoryLists struct {
+	s *memoryStore
+}
+
+func (r memoryLists) Lists(ctx context.Context, user User, query PageQuery) ([]List, string, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return nil, "", err
+	}
+	defer r.s.mu.Unlock()
+
+	query.Completed = nil
+	var rows []memoryRow
+	for _, list := range r.s.lists {
+		if list.UserID == user.ID && list.DeletedAt == nil {
+			rows = append(rows, memoryRow{id: list.ID, name: list.Name, createdAt: list.CreatedAt})
+		}
+	}
+	ids, next, err := query.pageRows(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lists := []List{}
+	for _, id := range ids {
+		lists = append(lists, r.s.lists[id])
+	}
+	return lists, next, nil
+}
+
+func (r memoryLists) Get(ctx context.Context, id int) (List, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return List{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	list, ok := r.s.liveList(id)
+	if !ok {
+		return List{}, notFound("list", id)
+	}
+	return list, nil
+}
+
+func (r memoryLists) Create(ctx context.Context, user User, name string) (List, error) {
+	if err := checkListName(name); err != nil {
+		return List{}, err
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return List{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	if _, taken := r.s.listNamed(user.ID, name, 0); taken {
+		return List{}, fmt.Errorf("list %q already exists: %w", name, ErrConflict)
+	}
+	return r.s.insertList(user, name, now()), nil
+}
+
+func (r memoryLists) Rename(ctx context.Context, id int, name string) (List, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return List{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	list, ok := r.s.liveList(id)
+	if !ok {
+		return List{}, notFound("list", id)
+	}
+	if err := checkListName(name); err != nil {
+		return List{}, err
+	}
+	if _, taken := r.s.listNamed(list.UserID, name, id); taken {
+		return List{}, fmt.Errorf("list %q already exists: %w", name, ErrConflict)
+	}
+
+	list.Name = name
+	list.UpdatedAt = now()
+	r.s.lists[id] = list
+	return list, nil
+}
+
+func (r memoryLists) Delete(ctx context.Context, id int) (int, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.mu.Unlock()
+
+	list, ok := r.s.liveList(id)
+	if !ok {
+		return 0, notFound("list", id)
+	}
+	tasks := 0
+	for _, task := range r.s.tasks {
+		if task.ListID == id && task.DeletedAt == nil {
+			tasks++
+		}
+	}
+	deletedAt := now()
+	list.DeletedAt = &deletedAt
+	r.s.lists[id] = list
+	return tasks, nil
+}
+
+func (r memoryLists) OwnedBy(ctx context.Context, id int, user User) (bool, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer r.s.mu.Unlock()
+
+	list, ok := r.s.liveList(id)
+	return ok && list.UserID == user.ID, nil
+}
+
+func (r memoryLists) Trash(ctx context.Context, user User) ([]List, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.mu.Unlock()
+
+	lists := []List{}
+	for _, list := range r.s.lists {
+		if list.UserID == user.ID && list.DeletedAt != nil {
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		return trashedBefore(*lists[j].DeletedAt, lists[j].ID, *lists[i].DeletedAt, lists[i].ID)
+	})
+	return lists, nil
+}
+
+func (r memoryLists) Restore(ctx context.Context, user User, id int) (List, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return List{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	list, ok := r.s.lists[id]
+	if !ok || list.UserID != user.ID || list.DeletedAt == nil {
+		return List{}, notFound("list", id)
+	}
+	if _, taken := r.s.listNamed(user.ID, list.Name, id); taken {
+		return List{}, fmt.Errorf("list %q already exists: %w", list.Name, ErrConflict)
+	}
+
+	list.DeletedAt = nil
+	r.s.lists[id] = list
+	return list, nil
+}
+
+func (r memoryLists) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.mu.Unlock()
+
+	purged := 0
+	for id, list := range r.s.lists {
+		if list.DeletedAt == nil || !list.DeletedAt.Before(cutoff) {
+			continue
+		}
+		for taskID, task := range r.s.tasks {
+			if task.ListID == id {
+				delete(r.s.tasks, taskID)
+				delete(r.s.reminded, taskID)
+			}
+		}
+		delete(r.s.lists, id)
+		purged++
+	}
+	return purged, nil
+}
+
+// trashedBefore orders the trash by deletion time, then by id.
+func trashedBefore(deletedAt time.Time, id int, otherDeletedAt time.Time, otherID int) bool {
+	if !deletedAt.Equal(otherDeletedAt) {
+		return deletedAt.Before(otherDeletedAt)
+	}
+	return id < otherID
+}
+
+type memoryTasks struct {
+	s *memoryStore
+}
+
+func (r memoryTasks) Tasks(ctx context.Context, listID int, query PageQuery) ([]Task, string, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return nil, "", err
+	}
+	defer r.s.mu.Unlock()
+
+	var rows []memoryRow
+	for _, task := range r.s.tasks {
+		if task.ListID == listID && task.DeletedAt == nil {
+			rows = append(rows, memoryRow{id: task.ID, name: task.Name, createdAt: task.CreatedAt, completed: task.Completed})
+		}
+	}
+	ids, next, err := query.pageRows(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tasks := []Task{}
+	for _, id := range ids {
+		tasks = append(tasks, r.s.tasks[id])
+	}
+	return tasks, next, nil
+}
+
+func (r memoryTasks) Get(ctx context.Context, id int) (Task, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return Task{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	task, ok := r.s.liveTask(id)
+	if !ok {
+		return Task{}, notFound("task", id)
+	}
+	return task, nil
+}
+
+func (r memoryTasks) Create(ctx context.Context, listID int, task NewTask) (Task, error) {
+	if strings.TrimSpace(task.Text) == "" {
+		return Task{}, &ValidationError{Field: "text", Message: "must not be empty"}
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return Task{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.lists[listID]; !ok {
+		return Task{}, notFound("list", listID)
+	}
+	createdAt := now()
+	return r.s.insertTask(Task{Name: task.Text, ListID: listID, CreatedAt: createdAt, UpdatedAt: createdAt,
+		DueAt: utcTime(task.DueAt), RemindAt: utcTime(task.RemindAt)}), nil
+}
+
+func (r memoryTasks) Update(ctx context.Context, id int, update TaskUpdate) (Task, error) {
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return Task{}, &ValidationError{Field: "text", Message: "must not be empty"}
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return Task{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	task, ok := r.s.liveTask(id)
+	if !ok {
+		return Task{}, notFound("task", id)
+	}
+	if update.ListID != nil {
+		if _, ok := r.s.lists[*update.ListID]; !ok {
+			return Task{}, notFound("list", *update.ListID)
+		}
+	}
+
+	updatedAt := now()
+	if update.Name != nil {
+		task.Name = *update.Name
+	}
+	if update.ListID != nil {
+		task.ListID = *update.ListID
+	}
+	if update.Completed != nil {
+		task.Completed = *update.Completed
+		// the first completion time is kept when a task is completed again
+		if !task.Completed {
+			task.CompletedAt = nil
+		} else if task.CompletedAt == nil {
+			task.CompletedAt = &updatedAt
+		}
+	}
+	if update.DueAt.Set {
+		task.DueAt = update.DueAt.value()
+	}
+	if update.RemindAt.Set {
+		task.RemindAt = update.RemindAt.value()
+		delete(r.s.reminded, id)
+	}
+	task.UpdatedAt = updatedAt
+	r.s.tasks[id] = task
+	return task, nil
+}
+
+func (r memoryTasks) Delete(ctx context.Context, id int) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.mu.Unlock()
+
+	task, ok := r.s.liveTask(id)
+	if !ok {
+		return notFound("task", id)
+	}
+	deletedAt := now()
+	task.DeletedAt = &deletedAt
+	r.s.tasks[id] = task
+	return nil
+}
+
+func (r memoryTasks) OwnedBy(ctx context.Context, id int, user User) (bool, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer r.s.mu.Unlock()
+
+	task, ok := r.s.tasks[id]
+	return ok && r.s.visible(task) && r.s.taskOwnedBy(task, user), nil
+}
+
+func (r memoryTasks) Trash(ctx context.Context, user User) ([]Task, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.mu.Unlock()
+
+	tasks := []Task{}
+	for _, task := range r.s.tasks {
+		if _, live := r.s.liveList(task.ListID); live && task.DeletedAt != nil && r.s.taskOwnedBy(task, user) {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return trashedBefore(*tasks[j].DeletedAt, tasks[j].ID, *tasks[i].DeletedAt, tasks[i].ID)
+	})
+	return tasks, nil
+}
+
+func (r memoryTasks) Restore(ctx context.Context, user User, id int) (Task, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return Task{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	task, ok := r.s.tasks[id]
+	if _, live := r.s.liveList(task.ListID); !ok || !live || task.DeletedAt == nil || !r.s.taskOwnedBy(task, user) {
+		return Task{}, notFound("task", id)
+	}
+
+	task.DeletedAt = nil
+	r.s.tasks[id] = task
+	return task, nil
+}
+
+func (r memoryTasks) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.mu.Unlock()
+
+	purged := 0
+	for id, task := range r.s.tasks {
+		if task.DeletedAt != nil && task.DeletedAt.Before(cutoff) {
+			delete(r.s.tasks, id)
+			delete(r.s.reminded, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r memoryTasks) Due(ctx context.Context, user User, query DueQuery) ([]Task, error) {
+	w, err := query.window(now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.mu.Unlock()
+
+	tasks := []Task{}
+	for _, task := range r.s.tasks {
+		if r.s.visible(task) && r.s.taskOwnedBy(task, user) && w.contains(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].DueAt.Equal(*tasks[j].DueAt) {
+			return tasks[i].DueAt.Before(*tasks[j].DueAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks, nil
+}
+
+func (r memoryTasks) Reminders(ctx context.Context, until time.Time) ([]Reminder, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.mu.Unlock()
+
+	reminders := []Reminder{}
+	for _, task := range r.s.tasks {
+		if task.RemindAt == nil || task.RemindAt.After(until) || r.s.reminded[task.ID] || task.Completed || !r.s.visible(task) {
+			continue
+		}
+		list := r.s.lists[task.ListID]
+		user := r.s.users[list.UserID]
+		reminders = append(reminders, Reminder{Task: task, ListName: list.Name, UserID: user.ID, Username: user.Username})
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		a, b := reminders[i].Task, reminders[j].Task
+		if !a.RemindAt.Equal(*b.RemindAt) {
+			return a.RemindAt.Before(*b.RemindAt)
+		}
+		return a.ID < b.ID
+	})
+	return reminders, nil
+}
+
+func (r memoryTasks) MarkReminded(ctx context.Context, id int) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.tasks[id]; !ok {
+		return notFound("task", id)
+	}
+	r.s.reminded[id] = true
+	return nil
+}
+
+// Search matches like the FTS5 query of SearchTasks: every word of query has
+// to start a word of the task, words being runs of letters and digits
+// compared ignoring case. There is no ranking; results come in id order.
+func (r memoryTasks) Search(ctx context.Context, user User, query string, limit int) ([]SearchResult, error) {
+	limit, err := searchLimit(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.mu.Unlock()
+
+	var phrases [][]string
+	for _, word := range strings.Fields(query) {
+		phrases = append(phrases, searchWords(word))
+	}
+
+	results := []SearchResult{}
+	for _, task := range r.s.tasks {
+		if !r.s.visible(task) || !r.s.taskOwnedBy(task, user) {
+			continue
+		}
+		words := searchWords(task.Name)
+		matches := true
+		for _, phrase := range phrases {
+			matches = matches && containsPhrase(words, phrase)
+		}
+		if matches {
+			results = append(results, SearchResult{Task: task, ListID: task.ListID, ListName: r.s.lists[task.ListID].Name})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Task.ID < results[j].Task.ID })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// containsPhrase tells whether phrase occurs in words with its last word as a
+// prefix, which is how FTS5 treats a quoted query word like "it's"*.
+func containsPhrase(words, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	last := len(phrase) - 1
+	for start := 0; start+len(phrase) <= len(words); start++ {
+		matches := strings.HasPrefix(words[start+last], phrase[last])
+		for i := 0; matches && i < last; i++ {
+			matches = words[start+i] == phrase[i]
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Export copies the tasks before encoding them, so that a slow client does
+// not hold up the store.
+func (r memoryTasks) Export(ctx context.Context, user User, w io.Writer, format ExportFormat, listID int) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	var tasks []ExportedTask
+	for _, task := range r.s.tasks {
+		list := r.s.lists[task.ListID]
+		if !r.s.visible(task) || !r.s.taskOwnedBy(task, user) || listID != 0 && list.ID != listID {
+			continue
+		}
+		tasks = append(tasks, ExportedTask{
+			ID:          task.ID,
+			ListID:      list.ID,
+			ListName:    list.Name,
+			Text:        task.Name,
+			Completed:   task.Completed,
+			CreatedAt:   task.CreatedAt,
+			UpdatedAt:   task.UpdatedAt,
+			CompletedAt: task.CompletedAt,
+			DueAt:       task.DueAt,
+		})
+	}
+	r.s.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].ListID != tasks[j].ListID {
+			return tasks[i].ListID < tasks[j].ListID
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+
+	encoder := format.newEncoder(w)
+	if err := encoder.Begin(); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if err := encoder.Encode(task); err != nil {
+			return err
+		}
+	}
+	return encoder.End()
+}
+
+// Import is ImportTasks. The rows are valid already, so nothing can fail
+// halfway and a dry run only has to skip the inserts.
+func (r memoryTasks) Import(ctx context.Context, user User, rows []ImportRow, dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, ListsCreated: []string{}, ListsReused: []string{}, Errors: []ImportError{}}
+
+	if err := r.s.lock(ctx); err != nil {
+		return report, err
+	}
+	defer r.s.mu.Unlock()
+
+	importedAt := now()
+	listIDs := map[string]int{}
+	for _, row := range rows {
+		listID, ok := listIDs[row.ListName]
+		if !ok {
+			if list, found := r.s.listNamed(user.ID, row.ListName, 0); found {
+				listID = list.ID
+				report.ListsReused = append(report.ListsReused, row.ListName)
+			} else {
+				if !dryRun {
+					listID = r.s.insertList(user, row.ListName, importedAt).ID
+				}
+				report.ListsCreated = append(report.ListsCreated, row.ListName)
+			}
+			listIDs[row.ListName] = listID
+		}
+
+		createdAt := importedAt
+		if row.CreatedAt != nil {
+			createdAt = *row.CreatedAt
+		}
+		var completedAt *time.Time
+		if row.Completed {
+			completedAt = row.CompletedAt
+			if completedAt == nil {
+				completedAt = &importedAt
+			}
+		}
+
+		if !dryRun {
+			r.s.insertTask(Task{Name: row.Text, ListID: listID, Completed: row.Completed, CreatedAt: createdAt, UpdatedAt: importedAt, CompletedAt: completedAt, DueAt: row.DueAt})
+		}
+		report.TasksCreated++
+	}
+	return report, nil
+}
+
+type memoryUsers struct {
+	s *memoryStore
+}
+
+func (r memoryUsers) Create(ctx context.Context, username, password string) (User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return User{}, fmt.Errorf("hash password: %w", err)
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return User{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Username == username {
+			return User{}, fmt.Errorf("username %q is taken: %w", username, ErrConflict)
+		}
+	}
+	r.s.lastUserID++
+	user := User{ID: r.s.lastUserID, Username: username, Password: string(hashedPassword)}
+	r.s.users[user.ID] = user
+	return user, nil
+}
+
+func (r memoryUsers) Get(ctx context.Context, id int) (User, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return User{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return User{}, notFound("user", id)
+	}
+	return user, nil
+}
+
+func (r memoryUsers) GetByUsername(ctx context.Context, username string) (User, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return User{}, err
+	}
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return User{}, fmt.Errorf("user %q %w", username, ErrNotFound)
+}
+
+func (r memoryUsers) UpdatePassword(ctx context.Context, user User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[user.ID]
+	if !ok {
+		return notFound("user", user.ID)
+	}
+	changedAt := now()
+	stored.Password = string(hashedPassword)
+	stored.PasswordChangedAt = &changedAt
+	r.s.users[user.ID] = stored
+	return nil
+}
+
+func (r memoryUsers) Delete(ctx context.Context, user User) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[user.ID]; !ok {
+		return notFound("user", user.ID)
+	}
+	for id, task := range r.s.tasks {
+		if r.s.taskOwnedBy(task, user) {
+			delete(r.s.tasks, id)
+		}
+	}
+	for id, list := range r.s.lists {
+		if list.UserID == user.ID {
+			delete(r.s.lists, id)
+		}
+	}
+	delete(r.s.users, user.ID)
+	return nil
+}
+
+func (r memoryUsers) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer r.s.mu.Unlock()
+
+	for id, expires := range r.s.revoked {
+		if expires.Before(time.Now()) {
+			delete(r.s.revoked, id)
+		}
+	}
+	if _, ok := r.s.revoked[jti]; ok {
+		return false, nil
+	}
+	r.s.revoked[jti] = expiresAt
+	return true, nil
+}
+
+func (r memoryUsers) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer r.s.mu.Unlock()
+
+	_, revoked := r.s.revoked[jti]
+	return revoked, nil
+}
@@ -1,21 +1,28 @@
 package models
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
-	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	_ "modernc.org/sqlite"
 )
 
+const MaxListNameLength = 100
+
 type List struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	UserID int
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	UserID    int
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// DeletedAt is set while the list is in the trash.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
 }
 
 type ListCollection struct {
@@ -23,10 +30,61 @@ type ListCollection struct {
 }
 
 type Task struct {
-	ID        int    `json:"id"`
-	Name      string `json:"text"`
-	ListID    int    `json:"listId"`
-	Completed bool   `json:"completed"`
+	ID          int        `json:"id"`
+	Name        string     `json:"text"`
+	ListID      int        `json:"listId"`
+	Completed   bool       `json:"completed"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	DueAt       *time.Time `json:"dueAt"`
+	RemindAt    *time.Time `json:"remindAt"`
+	// DeletedAt is set while the task is in the trash.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// MarshalJSON adds "touched", the last update in Unix milliseconds, which the
+// React client sorts tasks by.
+func (t Task) MarshalJSON() ([]byte, error) {
+	type task Task
+	return json.Marshal(struct {
+		task
+		Touched int64 `json:"touched"`
+	}{task(t), t.UpdatedAt.UnixMilli()})
+}
+
+// NewTask is a task to be created; the due and reminder times are optional.
+type NewTask struct {
+	Text     string     `json:"text"`
+	DueAt    *time.Time `json:"dueAt"`
+	RemindAt *time.Time `json:"remindAt"`
+}
+
+// TaskUpdate is a partial update of a task; nil fields are left unchanged.
+type TaskUpdate struct {
+	Name      *string    `json:"text"`
+	Completed *bool      `json:"completed"`
+	ListID    *int       `json:"listId"`
+	DueAt     TimeUpdate `json:"dueAt"`
+	RemindAt  TimeUpdate `json:"remindAt"`
+}
+
+// TimeUpdate is an optional time in a partial update. Unlike a plain pointer
+// it tells an absent field, which is left unchanged, from null, which clears
+// the time.
+type TimeUpdate struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (u *TimeUpdate) UnmarshalJSON(data []byte) error {
+	u.Set = true
+	return json.Unmarshal(data, &u.Time)
+}
+
+// value is the time to store, or nil to clear it.
+func (u TimeUpdate) value() *time.Time {
+	return utcTime(u.Time)
 }
 
 type TaskCollection struct {
@@ -34,235 +92,310 @@ type TaskCollection struct {
 }
 
 type User struct {
-	ID       int
-	Username string
-	Password string
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"-"`
+	// PasswordChangedAt is when the password was last changed, nil if never.
+	// Tokens issued before it are no longer accepted.
+	PasswordChangedAt *time.Time `json:"-"`
 }
 
-type Weather struct {
-	Weather []struct {
-		Description string `json:"description"`
-	} `json:"weather,omitempty"`
+const (
+	taskColumns = "id, name, list_id, completed, created_at, updated_at, completed_at, deleted_at, due_at, remind_at"
+	listColumns = "id, name, user_id, created_at, updated_at, deleted_at"
+	userColumns = "id, username, password, password_changed_at"
+)
 
-	Main struct {
-		Temp float64 `json:"temp"`
-	} `json:"main,omitempty"`
+// qualifiedTaskColumns are the task columns for queries that join tasks as t.
+var qualifiedTaskColumns = "t." + strings.ReplaceAll(taskColumns, ", ", ", t.")
 
-	City string `json:"name,omitempty"`
+// now is the clock behind all stored timestamps.
+var now = func() time.Time {
+	return time.Now().UTC()
 }
 
-type WeatherInfo struct {
-	FormatedTemp string `json:"formatedTemp"`
-	Description  string `json:"description"`
-	City         string `json:"city"`
+type scanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func GetTasks(db *sql.DB, listID int) []Task {
-	rows, err := db.Query("SELECT * FROM tasks WHERE list_id = ?", listID)
+func scanTask(row scanner) (Task, error) {
+	task := Task{}
+	var createdAt, updatedAt, completedAt, deletedAt, dueAt, remindAt sql.NullTime
+	err := row.Scan(&task.ID, &task.Name, &task.ListID, &task.Completed, &createdAt, &updatedAt, &completedAt, &deletedAt, &dueAt, &remindAt)
+
+	task.CreatedAt = createdAt.Time.UTC()
+	task.UpdatedAt = updatedAt.Time.UTC()
+	task.CompletedAt = nullTime(completedAt)
+	task.DeletedAt = nullTime(deletedAt)
+	task.DueAt = nullTime(dueAt)
+	task.RemindAt = nullTime(remindAt)
+	return task, err
+}
 
-	if err != nil {
-		panic(err)
-	}
-	r := TaskCollection{}
-	for rows.Next() {
-		task := Task{}
-		err2 := rows.Scan(&task.ID, &task.Name, &task.ListID, &task.Completed)
+func scanList(row scanner) (List, error) {
+	list := List{}
+	var createdAt, updatedAt, deletedAt sql.NullTime
+	err := row.Scan(&list.ID, &list.Name, &list.UserID, &createdAt, &updatedAt, &deletedAt)
 
-		if err2 != nil {
-			panic(err2)
-		}
-		r.Tasks = append(r.Tasks, task)
-	}
-	if r.Tasks == nil {
-		emptyTaskList := []Task{}
-		return emptyTaskList
-	}
-	return r.Tasks
+	list.CreatedAt = createdAt.Time.UTC()
+	list.UpdatedAt = updatedAt.Time.UTC()
+	list.DeletedAt = nullTime(deletedAt)
+	return list, err
 }
 
-func CreateTask(db *sql.DB, name string, listID int) (Task, error) {
-	result, err := db.Exec("INSERT INTO tasks(name, list_id,completed) VALUES(?,?,?);", name, listID, 0)
+func scanUser(row scanner) (User, error) {
+	user := User{}
+	var passwordChangedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &passwordChangedAt)
 
-	if err != nil {
-		panic(err)
-	}
-
-	taskID, err := result.LastInsertId()
+	user.PasswordChangedAt = nullTime(passwordChangedAt)
+	return user, err
+}
 
-	if err != nil {
-		panic(err)
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
 	}
+	utc := t.Time.UTC()
+	return &utc
+}
 
-	rows, err := db.Query("SELECT * FROM tasks WHERE id = ?", taskID)
-	if err != nil {
-		panic(err)
+// utcTime converts t to UTC, as SQLite compares stored times as text.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
 	}
+	utc := t.UTC()
+	return &utc
+}
 
-	task := Task{}
-	for rows.Next() {
-		err2 := rows.Scan(&task.ID, &task.Name, &task.ListID, &task.Completed)
-
-		if err2 != nil {
-			panic(err2)
-		}
-	}
-	return task, nil
+func GetTasks(ctx context.Context, db *sql.DB, listID int) ([]Task, error) {
+	tasks, _, err := QueryTasks(ctx, db, listID, PageQuery{})
+	return tasks, err
 }
 
-func UpdateTask(db *sql.DB, id int) (Task, error) {
-	query := "UPDATE TASKS SET completed = NOT completed WHERE id = (?)"
-	_, err := db.Exec(query, id)
+func GetTask(ctx context.Context, db *sql.DB, id int) (Task, error) {
+	task, err := scanTask(db.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = $1 AND deleted_at IS NULL", id))
 
-	if err != nil {
-		panic(err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, notFound("task", id)
 	}
-
-	rows, err := db.Query("SELECT * FROM tasks WHERE id = ?", id)
 	if err != nil {
-		panic(err)
-	}
-
-	task := Task{}
-	for rows.Next() {
-		err2 := rows.Scan(&task.ID, &task.Name, &task.ListID, &task.Completed)
-
-		if err2 != nil {
-			panic(err2)
-		}
+		return Task{}, fmt.Errorf("query task %d: %w", id, err)
 	}
 	return task, nil
 }
 
-func DeleteTask(db *sql.DB, id int) (int64, error) {
-	result, err := db.Exec("DELETE FROM tasks WHERE id = ?", id)
+func CreateTask(ctx context.Context, db *sql.DB, task NewTask, listID int) (Task, error) {
+	if strings.TrimSpace(task.Text) == "" {
+		return Task{}, &ValidationError{Field: "text", Message: "must not be empty"}
+	}
+
+	var taskID int
+	createdAt := now()
+	err := db.QueryRowContext(ctx, "INSERT INTO tasks(name, list_id, completed, created_at, updated_at, due_at, remind_at) VALUES($1,$2,$3,$4,$4,$5,$6) RETURNING id",
+		task.Text, listID, false, createdAt, utcTime(task.DueAt), utcTime(task.RemindAt)).Scan(&taskID)
 
+	if isForeignKeyViolation(err) {
+		return Task{}, notFound("list", listID)
+	}
 	if err != nil {
-		panic(err)
+		return Task{}, fmt.Errorf("insert task: %w", err)
 	}
 
-	return result.RowsAffected()
+	return GetTask(ctx, db, taskID)
 }
 
-func ExportTasksCSV(db *sql.DB, loggedUser User) error {
-	rows, err := db.Query("SELECT t.* FROM tasks AS t LEFT JOIN lists AS l ON l.id = t.list_id WHERE l.user_id = ?", loggedUser.ID)
+func UpdateTask(ctx context.Context, db *sql.DB, id int, update TaskUpdate) (Task, error) {
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return Task{}, &ValidationError{Field: "text", Message: "must not be empty"}
+	}
 
+	// completed_at keeps the first completion time when a task is completed
+	// again, and a new reminder time is reminded of afresh
+	query := `UPDATE tasks SET
+		name = COALESCE($1, name),
+		list_id = COALESCE($2, list_id),
+		completed_at = CASE WHEN CAST($3 AS BOOLEAN) IS NULL THEN completed_at WHEN CAST($3 AS BOOLEAN) THEN COALESCE(completed_at, $4) ELSE NULL END,
+		completed = COALESCE($3, completed),
+		due_at = CASE WHEN CAST($6 AS BOOLEAN) THEN $7 ELSE due_at END,
+		reminded_at = CASE WHEN CAST($8 AS BOOLEAN) THEN NULL ELSE reminded_at END,
+		remind_at = CASE WHEN CAST($8 AS BOOLEAN) THEN $9 ELSE remind_at END,
+		updated_at = $4
+		WHERE id = $5 AND deleted_at IS NULL`
+	result, err := db.ExecContext(ctx, query, update.Name, update.ListID, update.Completed, now(), id,
+		update.DueAt.Set, update.DueAt.value(), update.RemindAt.Set, update.RemindAt.value())
+
+	if isForeignKeyViolation(err) {
+		return Task{}, notFound("list", *update.ListID)
+	}
 	if err != nil {
-		panic(err)
+		return Task{}, fmt.Errorf("update task %d: %w", id, err)
 	}
 
-	r := TaskCollection{}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return Task{}, fmt.Errorf("update task %d: %w", id, err)
+	}
+	if affected == 0 {
+		return Task{}, notFound("task", id)
+	}
 
-	for rows.Next() {
-		task := Task{}
-		err2 := rows.Scan(&task.ID, &task.Name, &task.ListID, &task.Completed)
+	return GetTask(ctx, db, id)
+}
 
-		if err2 != nil {
-			panic(err2)
-		}
-		r.Tasks = append(r.Tasks, task)
-	}
+// DeleteTask moves a task to the trash.
+func DeleteTask(ctx context.Context, db *sql.DB, id int) (int64, error) {
+	result, err := db.ExecContext(ctx, "UPDATE tasks SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", now(), id)
 
-	file, err := os.Create("result.csv")
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("delete task %d: %w", id, err)
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	var tasksReadyForImport []string
-	for _, task := range r.Tasks {
-		tasksReadyForImport = append(tasksReadyForImport, task.Name)
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete task %d: %w", id, err)
 	}
-
-	if err := writer.Write(tasksReadyForImport); err != nil {
-		return err
+	if affected == 0 {
+		return 0, notFound("task", id)
 	}
+	return affected, nil
+}
 
-	return nil
+func GetLists(ctx context.Context, db *sql.DB, user User) ([]List, error) {
+	lists, _, err := QueryLists(ctx, db, user, PageQuery{})
+	return lists, err
 }
 
-func GetLists(db *sql.DB, loggedUser User) []List {
-	rows, err := db.Query("SELECT * FROM lists WHERE user_id = ?", loggedUser.ID)
+func GetList(ctx context.Context, db *sql.DB, id int) (List, error) {
+	list, err := scanList(db.QueryRowContext(ctx, "SELECT "+listColumns+" FROM lists WHERE id = $1 AND deleted_at IS NULL", id))
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return List{}, notFound("list", id)
+	}
 	if err != nil {
-		panic(err)
+		return List{}, fmt.Errorf("query list %d: %w", id, err)
 	}
+	return list, nil
+}
 
-	defer rows.Close()
+func CreateList(ctx context.Context, db *sql.DB, name string, user User) (int64, error) {
+	if err := validateListName(ctx, db, name, user.ID, 0); err != nil {
+		return 0, err
+	}
 
-	result := ListCollection{}
-	for rows.Next() {
-		list := List{}
-		err2 := rows.Scan(&list.ID, &list.Name, &list.UserID)
+	var id int64
+	createdAt := now()
+	err := db.QueryRowContext(ctx, "INSERT INTO lists(name, user_id, created_at, updated_at) VALUES($1,$2,$3,$3) RETURNING id", name, user.ID, createdAt).Scan(&id)
 
-		if err2 != nil {
-			panic(err2)
-		}
-		result.Lists = append(result.Lists, list)
+	if err != nil {
+		return 0, fmt.Errorf("insert list: %w", err)
 	}
 
-	if result.Lists == nil {
-		emptyList := []List{}
-		return emptyList
-	}
-	return result.Lists
+	return id, nil
 }
 
-func CreateList(db *sql.DB, name string, loggedUser User) (int64, error) {
-	result, err := db.Exec("INSERT INTO lists(name, user_id) VALUES(?,?);", name, loggedUser.ID)
-
+func RenameList(ctx context.Context, db *sql.DB, id int, name string) (List, error) {
+	list, err := GetList(ctx, db, id)
 	if err != nil {
-		panic(err)
+		return List{}, err
 	}
 
-	return result.LastInsertId()
-}
-
-func DeleteList(db *sql.DB, id int) error {
-	_, err := db.Exec("DELETE FROM lists WHERE id = ?", id)
+	if err := validateListName(ctx, db, name, list.UserID, id); err != nil {
+		return List{}, err
+	}
 
+	updatedAt := now()
+	result, err := db.ExecContext(ctx, "UPDATE lists SET name = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL", name, updatedAt, id)
+	if err != nil {
+		return List{}, fmt.Errorf("rename list %d: %w", id, err)
+	}
+	affected, err := result.RowsAffected()
 	if err != nil {
-		panic(err)
+		return List{}, fmt.Errorf("rename list %d: %w", id, err)
+	}
+	if affected == 0 {
+		return List{}, notFound("list", id)
 	}
 
-	_, err = db.Exec("DELETE FROM tasks WHERE list_id = ?", id)
+	list.Name = name
+	list.UpdatedAt = updatedAt
+	return list, nil
+}
 
-	if err != nil {
-		panic(err)
+// validateListName checks name for a list of userID. id is the list being
+// renamed, 0 for a new list.
+func validateListName(ctx context.Context, db *sql.DB, name string, userID int, id int) error {
+	if err := checkListName(name); err != nil {
+		return err
 	}
 
+	var taken bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM lists WHERE user_id = $1 AND name = $2 AND id != $3 AND deleted_at IS NULL)", userID, name, id).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("query lists: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("list %q already exists: %w", name, ErrConflict)
+	}
 	return nil
 }
 
-func GetWeather(lat string, lon string) WeatherInfo {
-	weather := Weather{}
-	apiKey := "8376a04ba3fd6b44983c55f31b28d93a"
+// checkListName applies the rules for list names that need no database.
+func checkListName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return &ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if utf8.RuneCountInString(name) > MaxListNameLength {
+		return &ValidationError{Field: "name", Message: fmt.Sprintf("must be at most %d characters long", MaxListNameLength)}
+	}
+	return nil
+}
 
-	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?lat=%s&lon=%s&appid=%s", lat, lon, apiKey)
+// DeleteList moves a list to the trash and returns how many of its tasks went
+// with it. The tasks keep their own deleted_at, so those trashed before stay
+// in the trash when the list is restored.
+func DeleteList(ctx context.Context, db *sql.DB, id int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("delete list %d: %w", id, err)
+	}
+	defer tx.Rollback()
 
-	req, err := http.NewRequest("GET", url, nil)
+	var tasks int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE list_id = $1 AND deleted_at IS NULL", id).Scan(&tasks)
 	if err != nil {
-		log.Println(err)
+		return 0, fmt.Errorf("count tasks of list %d: %w", id, err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	result, err := tx.ExecContext(ctx, "UPDATE lists SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", now(), id)
 	if err != nil {
-		log.Println(err)
+		return 0, fmt.Errorf("delete list %d: %w", id, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete list %d: %w", id, err)
+	}
+	if affected == 0 {
+		return 0, notFound("list", id)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Fatal("weather api response not ok")
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("delete list %d: %w", id, err)
 	}
+	return tasks, nil
+}
 
-	json.NewDecoder(resp.Body).Decode(&weather)
+func ListOwnedBy(ctx context.Context, db *sql.DB, listID int, user User) (bool, error) {
+	var owned bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM lists WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)", listID, user.ID).Scan(&owned)
 
-	weatherResponse := WeatherInfo{
-		FormatedTemp: fmt.Sprintf("%f Celsius", weather.Main.Temp-273.15),
-		Description:  weather.Weather[0].Description,
-		City:         weather.City,
-	}
-	return weatherResponse
+	return owned, err
+}
+
+func TaskOwnedBy(ctx context.Context, db *sql.DB, taskID int, user User) (bool, error) {
+	var owned bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks AS t JOIN lists AS l ON l.id = t.list_id WHERE t.id = $1 AND l.user_id = $2 AND t.deleted_at IS NULL AND l.deleted_at IS NULL)", taskID, user.ID).Scan(&owned)
+
+	return owned, err
 }
@@ -1,15 +1,32 @@
 package models
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/csv"
-	"log"
-	"os"
+	"encoding/json"
+	"errors"
+	"final/cmd/echo/migrations"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+func init() {
+	PasswordCost = bcrypt.MinCost
+}
+
 func TestCreateTask(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 
@@ -17,8 +34,8 @@ func TestCreateTask(t *testing.T) {
 		panic(err)
 	}
 
-	CreateTask(db, "prv", 1)
-	tasks := GetTasks(db, 1)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	tasks, _ := GetTasks(ctx, db, 1)
 
 	if len(tasks) != 1 {
 		t.Fatalf("expected 1 task, got %d", len(tasks))
@@ -26,6 +43,7 @@ func TestCreateTask(t *testing.T) {
 }
 
 func TestGetTasks(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 
@@ -33,16 +51,129 @@ func TestGetTasks(t *testing.T) {
 		panic(err)
 	}
 
-	CreateTask(db, "prv", 1)
-	CreateTask(db, "dva", 1)
-	tasks := GetTasks(db, 1)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	CreateTask(ctx, db, NewTask{Text: "dva"}, 1)
+	tasks, _ := GetTasks(ctx, db, 1)
 
 	if len(tasks) != 2 {
 		t.Fatalf("expected 2 tasks, got %d", len(tasks))
 	}
 }
 
+func TestQueryTasks(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer func() { now = func() time.Time { return time.Now().UTC() } }()
+	start := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, name := range []string{"mleko", "leb", "Kafe", "sirenje", "kafe_50%", "jajca", "domati"} {
+		now = func() time.Time { return start.Add(time.Duration(6-i) * time.Hour) }
+		CreateTask(ctx, db, NewTask{Text: name}, 1)
+	}
+	completed := true
+	UpdateTask(ctx, db, 2, TaskUpdate{Completed: &completed})
+	UpdateTask(ctx, db, 4, TaskUpdate{Completed: &completed})
+	CreateTask(ctx, db, NewTask{Text: "druga lista"}, 2)
+
+	names := func(tasks []Task) string {
+		var result []string
+		for _, task := range tasks {
+			result = append(result, task.Name)
+		}
+		return strings.Join(result, ",")
+	}
+	all := func(q PageQuery) []string {
+		var pages []string
+		for {
+			tasks, next, err := QueryTasks(ctx, db, 1, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages = append(pages, names(tasks))
+			if next == "" {
+				return pages
+			}
+			q.Cursor = next
+		}
+	}
+
+	tests := []struct {
+		query PageQuery
+		want  []string
+	}{
+		{PageQuery{}, []string{"mleko,leb,Kafe,sirenje,kafe_50%,jajca,domati"}},
+		{PageQuery{Limit: 3}, []string{"mleko,leb,Kafe", "sirenje,kafe_50%,jajca", "domati"}},
+		{PageQuery{Limit: 7}, []string{"mleko,leb,Kafe,sirenje,kafe_50%,jajca,domati"}},
+		{PageQuery{Limit: 3, Sort: "-id"}, []string{"domati,jajca,kafe_50%", "sirenje,Kafe,leb", "mleko"}},
+		{PageQuery{Limit: 4, Sort: "name"}, []string{"Kafe,domati,jajca,kafe_50%", "leb,mleko,sirenje"}},
+		{PageQuery{Limit: 2, Sort: "created"}, []string{"domati,jajca", "kafe_50%,sirenje", "Kafe,leb", "mleko"}},
+		{PageQuery{Limit: 2, Sort: "-created"}, []string{"mleko,leb", "Kafe,sirenje", "kafe_50%,jajca", "domati"}},
+		{PageQuery{Search: "KAFE"}, []string{"Kafe,kafe_50%"}},
+		{PageQuery{Search: "_5"}, []string{"kafe_50%"}},
+		{PageQuery{Search: "%"}, []string{"kafe_50%"}},
+		{PageQuery{Limit: 1, Completed: &completed}, []string{"leb", "sirenje"}},
+	}
+	for _, test := range tests {
+		if got := all(test.query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: expected pages %v, got %v", test.query, test.want, got)
+		}
+	}
+
+	_, next, _ := QueryTasks(ctx, db, 1, PageQuery{Limit: 1, Sort: "name"})
+	invalid := []PageQuery{
+		{Sort: "text"},
+		{Limit: MaxPageSize + 1},
+		{Cursor: "not a cursor"},
+		{Cursor: next, Sort: "-name"},
+	}
+	for _, query := range invalid {
+		var validationErr *ValidationError
+		if _, _, err := QueryTasks(ctx, db, 1, query); !errors.As(err, &validationErr) {
+			t.Errorf("%+v: expected a validation error, got %v", query, err)
+		}
+	}
+}
+
+func TestQueryLists(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	user := User{ID: 1}
+	for _, name := range []string{"rabota", "kukja", "patuvanje", "kupuvanje"} {
+		CreateList(ctx, db, name, user)
+	}
+	CreateList(ctx, db, "tugja", User{ID: 2})
+
+	lists, next, err := QueryLists(ctx, db, user, PageQuery{Limit: 2, Sort: "name", Search: "ku"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || lists[0].Name != "kukja" || lists[1].Name != "kupuvanje" || next != "" {
+		t.Fatalf("unexpected page %v, next %q", lists, next)
+	}
+
+	lists, next, _ = QueryLists(ctx, db, user, PageQuery{Limit: 3})
+	if len(lists) != 3 || next == "" {
+		t.Fatalf("expected a full first page with a cursor, got %v, next %q", lists, next)
+	}
+	lists, next, _ = QueryLists(ctx, db, user, PageQuery{Limit: 3, Cursor: next})
+	if len(lists) != 1 || lists[0].Name != "kupuvanje" || next != "" {
+		t.Fatalf("unexpected last page %v, next %q", lists, next)
+	}
+}
+
 func TestUpdateTask(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 
@@ -50,15 +181,122 @@ func TestUpdateTask(t *testing.T) {
 		panic(err)
 	}
 
-	task, _ := CreateTask(db, "prv", 1)
-	task, _ = UpdateTask(db, task.ID)
+	task, _ := CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	completed := true
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
 
 	if task.Completed != true {
 		t.Fatalf("expected true after update, got %t", task.Completed)
 	}
+
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+
+	if task.Completed != true {
+		t.Fatalf("expected completing twice to leave the task completed, got %t", task.Completed)
+	}
+}
+
+func TestUpdateTaskPartially(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	task, _ := CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	completed := true
+	UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+
+	name := "preimenuvan"
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{Name: &name})
+	if task.Name != name || !task.Completed || task.ListID != 1 {
+		t.Fatalf("expected only the name to change, got %+v", task)
+	}
+
+	listID := 2
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{ListID: &listID})
+	if task.Name != name || !task.Completed || task.ListID != 2 {
+		t.Fatalf("expected only the list to change, got %+v", task)
+	}
+
+	empty := " "
+	var validationErr *ValidationError
+	if _, err := UpdateTask(ctx, db, task.ID, TaskUpdate{Name: &empty}); !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+}
+
+func TestTaskUpdateJSON(t *testing.T) {
+	var update TaskUpdate
+	if err := json.Unmarshal([]byte(`{"dueAt": "2022-05-10T18:00:00+02:00", "remindAt": null}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	if !update.DueAt.Set || update.DueAt.Time == nil || !update.DueAt.Time.Equal(time.Date(2022, 5, 10, 16, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the due time to be set, got %+v", update.DueAt)
+	}
+	if !update.RemindAt.Set || update.RemindAt.Time != nil {
+		t.Fatalf("expected null to clear the reminder, got %+v", update.RemindAt)
+	}
+
+	update = TaskUpdate{}
+	if err := json.Unmarshal([]byte(`{"text": "x"}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.DueAt.Set || update.RemindAt.Set {
+		t.Fatalf("expected absent times to be left alone, got %+v", update)
+	}
+	if err := json.Unmarshal([]byte(`{"dueAt": "tomorrow"}`), &update); err == nil {
+		t.Fatal("expected an invalid time to be rejected")
+	}
+}
+
+func TestTaskTimestamps(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	clock := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = func() time.Time { return time.Now().UTC() } }()
+
+	created := clock
+	task, _ := CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	if !task.CreatedAt.Equal(created) || !task.UpdatedAt.Equal(created) || task.CompletedAt != nil {
+		t.Fatalf("unexpected timestamps after create: %+v", task)
+	}
+
+	clock = clock.Add(time.Hour)
+	completedAt := clock
+	completed := true
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+	if task.CompletedAt == nil || !task.CompletedAt.Equal(completedAt) || !task.UpdatedAt.Equal(completedAt) {
+		t.Fatalf("unexpected timestamps after completing: %+v", task)
+	}
+
+	clock = clock.Add(time.Hour)
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+	if task.CompletedAt == nil || !task.CompletedAt.Equal(completedAt) {
+		t.Fatalf("expected completing again to keep completed_at %v, got %v", completedAt, task.CompletedAt)
+	}
+	if !task.UpdatedAt.Equal(clock) || !task.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected timestamps after completing again: %+v", task)
+	}
+
+	completed = false
+	task, _ = UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+	if task.CompletedAt != nil {
+		t.Fatalf("expected completed_at to be cleared, got %v", task.CompletedAt)
+	}
 }
 
 func TestDeleteTask(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 
@@ -66,14 +304,14 @@ func TestDeleteTask(t *testing.T) {
 		panic(err)
 	}
 
-	CreateTask(db, "prv", 1)
-	tasks := GetTasks(db, 1)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	tasks, _ := GetTasks(ctx, db, 1)
 	if len(tasks) != 1 {
 		t.Fatalf("expected 1 task after creation, got %d", len(tasks))
 	}
 
-	DeleteTask(db, 1)
-	tasks = GetTasks(db, 1)
+	DeleteTask(ctx, db, 1)
+	tasks, _ = GetTasks(ctx, db, 1)
 
 	if len(tasks) != 0 {
 		t.Fatalf("expected 0 tasks after deletion, got %d", len(tasks))
@@ -81,6 +319,7 @@ func TestDeleteTask(t *testing.T) {
 }
 
 func TestExportTasksCSV(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 
@@ -94,22 +333,296 @@ func TestExportTasksCSV(t *testing.T) {
 		Password: "pass",
 	}
 
-	CreateList(db, "nova", user)
-	CreateTask(db, "prv", 1)
-	CreateTask(db, "prv", 1)
-	ExportTasksCSV(db, user)
-	records := readCsvFile("result.csv")
-	for _, strings := range records {
-		for _, v := range strings {
-			if v != "prv" {
-				t.Fatalf("expected prv list, got %s", v)
+	CreateList(ctx, db, "nova", user)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	task, _ := CreateTask(ctx, db, NewTask{Text: "vtor, so zapirka"}, 1)
+	completed := true
+	UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+	CreateList(ctx, db, "tugja", User{ID: 2})
+	CreateTask(ctx, db, NewTask{Text: "ne moja"}, 2)
+
+	var out bytes.Buffer
+	if err := ExportTasksCSV(ctx, db, &out, user, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %d records", len(records))
+	}
+	if !reflect.DeepEqual(records[0], CSVHeader) {
+		t.Fatalf("unexpected header %v", records[0])
+	}
+	if records[1][0] != "1" || records[1][2] != "nova" || records[1][3] != "prv" || records[1][4] != "false" || records[1][7] != "" {
+		t.Fatalf("unexpected first row %v", records[1])
+	}
+	if records[2][3] != "vtor, so zapirka" || records[2][4] != "true" || records[2][7] == "" {
+		t.Fatalf("unexpected second row %v", records[2])
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	user := User{ID: 1}
+	CreateList(ctx, db, "nova", user)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	task, _ := CreateTask(ctx, db, NewTask{Text: "vtor; so zapirka"}, 1)
+	completed := true
+	UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+	CreateList(ctx, db, "druga", user)
+	dueAt := time.Date(2022, 5, 10, 18, 0, 0, 0, time.UTC)
+	CreateTask(ctx, db, NewTask{Text: "tret", DueAt: &dueAt}, 2)
+
+	export := func(name string, listID int) string {
+		format, err := LookupExportFormat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := ExportTasks(ctx, db, &out, format, user, listID); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	var exported []ExportedTask
+	if err := json.Unmarshal([]byte(export("json", 0)), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 3 || exported[1].Text != "vtor; so zapirka" || !exported[1].Completed || exported[2].ListName != "druga" || exported[2].DueAt == nil {
+		t.Fatalf("unexpected json export %+v", exported)
+	}
+
+	want := "## nova\n\n- [ ] prv\n- [x] vtor; so zapirka\n\n## druga\n\n- [ ] tret (due 2022-05-10T18:00:00Z)\n"
+	if got := export("md", 0); got != want {
+		t.Fatalf("unexpected markdown export:\n%s", got)
+	}
+
+	ical := export("ical", 0)
+	for _, line := range []string{"BEGIN:VCALENDAR\r\n", "UID:task-2@final\r\n", "SUMMARY:vtor\\; so zapirka\r\n", "STATUS:COMPLETED\r\n", "DUE:20220510T180000Z\r\n", "END:VCALENDAR\r\n"} {
+		if !strings.Contains(ical, line) {
+			t.Fatalf("expected %q in ical export:\n%s", line, ical)
+		}
+	}
+	if strings.Count(ical, "BEGIN:VTODO") != 3 {
+		t.Fatalf("expected 3 VTODOs in ical export:\n%s", ical)
+	}
+
+	if got := export("markdown", 2); got != "## druga\n\n- [ ] tret (due 2022-05-10T18:00:00Z)\n" {
+		t.Fatalf("expected only list 2 in the filtered export, got:\n%s", got)
+	}
+
+	var validationErr *ValidationError
+	if _, err := LookupExportFormat("xlsx"); !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	alice, bob := User{ID: 1}, User{ID: 2}
+	CreateList(ctx, db, "nova", alice)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, 1)
+	task, _ := CreateTask(ctx, db, NewTask{Text: "vtor, so zapirka"}, 1)
+	completed := true
+	UpdateTask(ctx, db, task.ID, TaskUpdate{Completed: &completed})
+	CreateList(ctx, db, "vtora", alice)
+	dueAt := time.Date(2022, 5, 10, 18, 0, 0, 0, time.UTC)
+	CreateTask(ctx, db, NewTask{Text: "tret", DueAt: &dueAt}, 2)
+	CreateList(ctx, db, "nova", bob)
+
+	var out bytes.Buffer
+	if err := ExportTasksCSV(ctx, db, &out, alice, 0); err != nil {
+		t.Fatal(err)
+	}
+	exported := out.String()
+
+	format, _ := LookupExportFormat("csv")
+	rows, problems, err := ParseImport(strings.NewReader(exported), format)
+	if err != nil || len(problems) != 0 || len(rows) != 3 {
+		t.Fatalf("expected 3 valid rows, got %d rows, %v, %v", len(rows), problems, err)
+	}
+
+	report, err := ImportTasks(ctx, db, bob, rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TasksCreated != 3 || !reflect.DeepEqual(report.ListsCreated, []string{"vtora"}) || !reflect.DeepEqual(report.ListsReused, []string{"nova"}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	out.Reset()
+	if err := ExportTasksCSV(ctx, db, &out, bob, 0); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := csv.NewReader(strings.NewReader(exported)).ReadAll()
+	imported, _ := csv.NewReader(&out).ReadAll()
+	if len(imported) != len(original) {
+		t.Fatalf("expected %d records after the import, got %d", len(original), len(imported))
+	}
+	for i := 1; i < len(original); i++ {
+		// ids differ, names, state and creation, completion and due times survive
+		for _, column := range []int{2, 3, 4, 5, 7, 8} {
+			if original[i][column] != imported[i][column] {
+				t.Fatalf("row %d: expected %s %q, got %q", i, CSVHeader[column], original[i][column], imported[i][column])
 			}
+		}
+	}
+}
 
+func TestImportJSONTimesInUTC(t *testing.T) {
+	format, _ := LookupExportFormat("json")
+	input := `[{"listName": "nova", "text": "prv", "completed": true,
+		"createdAt": "2022-05-10T09:00:00+02:00", "completedAt": "2022-05-10T20:30:00+02:00", "dueAt": "2022-05-11T08:00:00-04:00"}]`
+	rows, problems, err := ParseImport(strings.NewReader(input), format)
+	if err != nil || len(problems) != 0 || len(rows) != 1 {
+		t.Fatalf("expected 1 valid row, got %v, %v, %v", rows, problems, err)
+	}
+
+	want := map[string]struct {
+		got  *time.Time
+		want time.Time
+	}{
+		"createdAt":   {rows[0].CreatedAt, time.Date(2022, 5, 10, 7, 0, 0, 0, time.UTC)},
+		"completedAt": {rows[0].CompletedAt, time.Date(2022, 5, 10, 18, 30, 0, 0, time.UTC)},
+		"dueAt":       {rows[0].DueAt, time.Date(2022, 5, 11, 12, 0, 0, 0, time.UTC)},
+	}
+	for field, times := range want {
+		// SQLite compares times as text, so they have to be stored in UTC
+		if times.got == nil || times.got.Location() != time.UTC || !times.got.Equal(times.want) {
+			t.Fatalf("expected %s %v in UTC, got %v", field, times.want, times.got)
 		}
 	}
 }
 
+func TestImportValidation(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	format, _ := LookupExportFormat("csv")
+	input := "list,text,completed\nnova,prv,false\n,bez lista,false\nnova,,maybe\n"
+	rows, problems, err := ParseImport(strings.NewReader(input), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 valid row, got %d", len(rows))
+	}
+	want := []ImportError{
+		{Row: 2, Field: "list", Message: "must not be empty"},
+		{Row: 3, Field: "completed", Message: "must be true or false"},
+		{Row: 3, Field: "text", Message: "must not be empty"},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Fatalf("expected %v, got %v", want, problems)
+	}
+
+	if _, _, err := ParseImport(strings.NewReader("name\nnova\n"), format); err == nil {
+		t.Fatal("expected a csv without list and text columns to be rejected")
+	}
+	jsonFormat, _ := LookupExportFormat("json")
+	if _, _, err := ParseImport(strings.NewReader("{"), jsonFormat); err == nil {
+		t.Fatal("expected malformed json to be rejected")
+	}
+	markdown, _ := LookupExportFormat("markdown")
+	if _, _, err := ParseImport(strings.NewReader(""), markdown); err == nil {
+		t.Fatal("expected markdown imports to be rejected")
+	}
+
+	report, err := ImportTasks(ctx, db, User{ID: 1}, rows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TasksCreated != 1 || len(report.ListsCreated) != 1 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if lists, _ := GetLists(ctx, db, User{ID: 1}); len(lists) != 0 {
+		t.Fatalf("expected a dry run to store nothing, got %v", lists)
+	}
+}
+
+func TestSearchTasks(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	alice, bob := User{ID: 1}, User{ID: 2}
+	CreateList(ctx, db, "kupuvanje", alice)
+	CreateList(ctx, db, "rabota", alice)
+	CreateList(ctx, db, "tugja", bob)
+	CreateTask(ctx, db, NewTask{Text: "kupi mleko i leb"}, 1)
+	CreateTask(ctx, db, NewTask{Text: "mleko"}, 1)
+	renamed, _ := CreateTask(ctx, db, NewTask{Text: "izvestaj"}, 2)
+	deleted, _ := CreateTask(ctx, db, NewTask{Text: "mlekarnica"}, 2)
+	CreateTask(ctx, db, NewTask{Text: "mleko za bob"}, 3)
+
+	name := "mleko vo izvestajot"
+	UpdateTask(ctx, db, renamed.ID, TaskUpdate{Name: &name})
+	DeleteTask(ctx, db, deleted.ID)
+
+	results, err := SearchTasks(ctx, db, alice, "mlek", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 of alice's tasks, got %+v", results)
+	}
+	if results[0].Task.Name != "mleko" {
+		t.Fatalf("expected the shortest match first, got %q", results[0].Task.Name)
+	}
+	for _, result := range results {
+		if result.Task.ID == deleted.ID || result.ListName == "tugja" {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+
+	results, _ = SearchTasks(ctx, db, alice, "IZVEST mleko", 0)
+	if len(results) != 1 || results[0].ListID != 2 || results[0].ListName != "rabota" {
+		t.Fatalf("expected the renamed task in rabota, got %+v", results)
+	}
+
+	results, err = SearchTasks(ctx, db, alice, `mleko" OR "leb NEAR(`, 0)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("expected operators to be matched literally, got %+v, %v", results, err)
+	}
+
+	var validationErr *ValidationError
+	if _, err := SearchTasks(ctx, db, alice, "  ", 0); !errors.As(err, &validationErr) {
+		t.Fatalf("expected an empty query to be rejected, got %v", err)
+	}
+	if _, err := SearchTasks(ctx, db, alice, "mleko", MaxSearchLimit+1); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a large limit to be rejected, got %v", err)
+	}
+}
+
 func TestCreateList(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 	var user User
@@ -117,8 +630,8 @@ func TestCreateList(t *testing.T) {
 		panic(err)
 	}
 
-	CreateList(db, "nova", user)
-	lists := GetLists(db, user)
+	CreateList(ctx, db, "nova", user)
+	lists, _ := GetLists(ctx, db, user)
 
 	if len(lists) != 1 {
 		t.Fatalf("expected 1 list, got %d", len(lists))
@@ -126,6 +639,7 @@ func TestCreateList(t *testing.T) {
 }
 
 func TestGetLists(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 	var user User
@@ -133,16 +647,112 @@ func TestGetLists(t *testing.T) {
 		panic(err)
 	}
 
-	CreateList(db, "nova", user)
-	CreateList(db, "vtor", user)
-	lists := GetLists(db, user)
+	CreateList(ctx, db, "nova", user)
+	CreateList(ctx, db, "vtor", user)
+	lists, _ := GetLists(ctx, db, user)
 
 	if len(lists) != 2 {
 		t.Fatalf("expected 2 lists, got %d", len(lists))
 	}
 }
 
+func TestGetList(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	user := User{ID: 1}
+	id, _ := CreateList(ctx, db, "nova", user)
+
+	list, err := GetList(ctx, db, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "nova" || list.UserID != user.ID {
+		t.Fatalf("unexpected list %+v", list)
+	}
+
+	if _, err := GetList(ctx, db, 42); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestListTimestamps(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	clock := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = func() time.Time { return time.Now().UTC() } }()
+
+	id, _ := CreateList(ctx, db, "nova", User{ID: 1})
+	clock = clock.Add(time.Minute)
+	RenameList(ctx, db, int(id), "stara")
+
+	list, _ := GetList(ctx, db, int(id))
+	if !list.CreatedAt.Equal(clock.Add(-time.Minute)) || !list.UpdatedAt.Equal(clock) {
+		t.Fatalf("unexpected timestamps %v and %v", list.CreatedAt, list.UpdatedAt)
+	}
+}
+
+func TestRenameList(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	user := User{ID: 1}
+	id, _ := CreateList(ctx, db, "nova", user)
+	CreateList(ctx, db, "vtor", user)
+
+	list, err := RenameList(ctx, db, int(id), "stara")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "stara" {
+		t.Fatalf("expected stara, got %s", list.Name)
+	}
+
+	if _, err := RenameList(ctx, db, int(id), "vtor"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, err := CreateList(ctx, db, "vtor", user); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, err := CreateList(ctx, db, "vtor", User{ID: 2}); err != nil {
+		t.Fatalf("expected other users to reuse the name, got %v", err)
+	}
+
+	var validationErr *ValidationError
+	if _, err := RenameList(ctx, db, int(id), strings.Repeat("a", MaxListNameLength+1)); !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if _, err := RenameList(ctx, db, 42, "treta"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := DeleteList(ctx, db, int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenameList(ctx, db, int(id), "treta"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a deleted list, got %v", err)
+	}
+}
+
 func TestDeleteList(t *testing.T) {
+	ctx := context.Background()
 	db, err := sql.Open("sqlite", ":memory:")
 	migrate(db)
 	var user User
@@ -150,70 +760,404 @@ func TestDeleteList(t *testing.T) {
 		panic(err)
 	}
 
-	id, _ := CreateList(db, "nova", user)
-	lists := GetLists(db, user)
+	id, _ := CreateList(ctx, db, "nova", user)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, int(id))
+	CreateTask(ctx, db, NewTask{Text: "vtor"}, int(id))
+	lists, _ := GetLists(ctx, db, user)
 	if len(lists) != 1 {
 		t.Errorf("expected 1 list after creation, got %d", len(lists))
 	}
 
-	DeleteList(db, int(id))
-	lists = GetLists(db, user)
+	tasks, err := DeleteList(ctx, db, int(id))
+	if err != nil || tasks != 2 {
+		t.Fatalf("expected the list and its 2 tasks to be deleted, got %d, %v", tasks, err)
+	}
+	lists, _ = GetLists(ctx, db, user)
 
 	if len(lists) != 0 {
 		t.Fatalf("expected 0 lists after deletion, got %d", len(lists))
 	}
 }
 
-func TestGetWeather(t *testing.T) {
-	want := "Skopje"
-	check := GetWeather("42", "21,41")
-	got := check.City
+func TestTaskNotFound(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
 
-	if !reflect.DeepEqual(got, want) {
-		t.Fatalf("Got: %v, want %v", got, want)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := GetTask(ctx, db, 42); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetTask: expected ErrNotFound, got %v", err)
+	}
+	if _, err := UpdateTask(ctx, db, 42, TaskUpdate{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateTask: expected ErrNotFound, got %v", err)
+	}
+	if _, err := DeleteTask(ctx, db, 42); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteTask: expected ErrNotFound, got %v", err)
+	}
+	if _, err := DeleteList(ctx, db, 42); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteList: expected ErrNotFound, got %v", err)
 	}
 }
 
-func migrate(db *sql.DB) {
-	sql := `
-	CREATE TABLE IF NOT EXISTS users(
-		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		username VARCHAR NOT NULL UNIQUE,
-		password VARCHAR NOT NULL
-	);
-    CREATE TABLE IF NOT EXISTS lists(
-        id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-        name VARCHAR NOT NULL,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-	CREATE TABLE IF NOT EXISTS tasks(
-		id INTEGER NOT NULL,
-		name VARCHAR NOT NULL,
-		list_id INTEGER NOT NULL,
-		completed INTEGER,
-		PRIMARY KEY (id),
-		FOREIGN KEY(list_id) REFERENCES lists(id)
-	);
-    `
-	_, err := db.Exec(sql)
+func TestCreateValidation(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
 	if err != nil {
 		panic(err)
 	}
+
+	var validationErr *ValidationError
+
+	if _, err := CreateTask(ctx, db, NewTask{Text: "  "}, 1); !errors.As(err, &validationErr) {
+		t.Fatalf("CreateTask: expected ValidationError, got %v", err)
+	}
+	if _, err := CreateList(ctx, db, "", User{ID: 1}); !errors.As(err, &validationErr) {
+		t.Fatalf("CreateList: expected ValidationError, got %v", err)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := CreateUser(ctx, db, "filipb", "blablabla")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("blablabla")) != nil {
+		t.Fatalf("expected the stored password to be a hash of the given one")
+	}
+
+	if _, err := CreateUser(ctx, db, "filipb", "other password"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	var validationErr *ValidationError
+
+	for _, password := range []string{"", "short", "filipbonevski", strings.Repeat("x", 73)} {
+		if err := ValidatePassword("filipbonevski", password); !errors.As(err, &validationErr) {
+			t.Fatalf("expected %q to be rejected, got %v", password, err)
+		}
+	}
+	if err := ValidatePassword("filipbonevski", "correct horse"); err != nil {
+		t.Fatalf("expected a valid password, got %v", err)
+	}
+}
+
+func TestGetUserByUsername(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	CreateUser(ctx, db, "filipb", "blablabla")
+
+	user, err := GetUserByUsername(ctx, db, "filipb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "filipb" || user.ID != 1 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	if _, err := GetUserByUsername(ctx, db, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
 }
 
-func readCsvFile(filePath string) [][]string {
-	f, err := os.Open(filePath)
+func TestUpdatePassword(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
 	if err != nil {
-		log.Fatal("Unable to read input file "+filePath, err)
+		panic(err)
 	}
-	defer f.Close()
 
-	csvReader := csv.NewReader(f)
-	records, err := csvReader.ReadAll()
+	user, _ := CreateUser(ctx, db, "filipb", "blablabla")
+	if err := UpdatePassword(ctx, db, user, "new password"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ = GetUserByUsername(ctx, db, "filipb")
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new password")) != nil {
+		t.Fatalf("expected the new password to be stored")
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
 	if err != nil {
-		log.Fatal("Unable to parse file as CSV for "+filePath, err)
+		panic(err)
 	}
 
-	return records
+	user, _ := CreateUser(ctx, db, "filipb", "blablabla")
+	other, _ := CreateUser(ctx, db, "dada", "blablabla")
+	id, _ := CreateList(ctx, db, "nova", user)
+	CreateTask(ctx, db, NewTask{Text: "prv"}, int(id))
+	otherID, _ := CreateList(ctx, db, "druga", other)
+	CreateTask(ctx, db, NewTask{Text: "vtor"}, int(otherID))
+
+	if err := DeleteUser(ctx, db, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetUserByUsername(ctx, db, "filipb"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the user to be gone, got %v", err)
+	}
+	if tasks, _ := GetTasks(ctx, db, int(id)); len(tasks) != 0 {
+		t.Fatalf("expected 0 tasks left in the deleted user's list, got %d", len(tasks))
+	}
+	if tasks, _ := GetTasks(ctx, db, int(otherID)); len(tasks) != 1 {
+		t.Fatalf("expected other users' tasks to stay, got %d", len(tasks))
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if revoked, _ := IsTokenRevoked(ctx, db, "abc"); revoked {
+		t.Fatalf("expected abc not to be revoked yet")
+	}
+
+	RevokeToken(ctx, db, "old", time.Now().Add(-time.Minute))
+	if revoked, err := RevokeToken(ctx, db, "abc", time.Now().Add(time.Hour)); err != nil || !revoked {
+		t.Fatalf("expected abc to be revoked by this call, got %v, %v", revoked, err)
+	}
+	if revoked, err := RevokeToken(ctx, db, "abc", time.Now().Add(time.Hour)); err != nil || revoked {
+		t.Fatalf("expected abc to be revoked already, got %v, %v", revoked, err)
+	}
+
+	if revoked, _ := IsTokenRevoked(ctx, db, "abc"); !revoked {
+		t.Fatalf("expected abc to be revoked")
+	}
+	if revoked, _ := IsTokenRevoked(ctx, db, "old"); revoked {
+		t.Fatalf("expected expired revocations to be purged")
+	}
+}
+
+func TestListOwnedBy(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	owner := User{ID: 1}
+	stranger := User{ID: 2}
+
+	id, _ := CreateList(ctx, db, "nova", owner)
+
+	if owned, _ := ListOwnedBy(ctx, db, int(id), owner); !owned {
+		t.Fatalf("expected list %d to be owned by user %d", id, owner.ID)
+	}
+	if owned, _ := ListOwnedBy(ctx, db, int(id), stranger); owned {
+		t.Fatalf("expected list %d not to be owned by user %d", id, stranger.ID)
+	}
+}
+
+func TestTaskOwnedBy(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	migrate(db)
+
+	if err != nil {
+		panic(err)
+	}
+
+	owner := User{ID: 1}
+	stranger := User{ID: 2}
+
+	id, _ := CreateList(ctx, db, "nova", owner)
+	task, _ := CreateTask(ctx, db, NewTask{Text: "prv"}, int(id))
+
+	if owned, _ := TaskOwnedBy(ctx, db, task.ID, owner); !owned {
+		t.Fatalf("expected task %d to be owned by user %d", task.ID, owner.ID)
+	}
+	if owned, _ := TaskOwnedBy(ctx, db, task.ID, stranger); owned {
+		t.Fatalf("expected task %d not to be owned by user %d", task.ID, stranger.ID)
+	}
+}
+
+func TestOpenWeatherMap(t *testing.T) {
+	status, body := http.StatusOK, `{"weather": [{"description": "clear sky", "icon": "01d"}], "main": {"temp": 27.04}, "name": "Skopje"}`
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow/weather" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		query = r.URL.Query()
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	provider := NewOpenWeatherMap("secret-key", server.URL+"/", time.Second)
+	info, err := provider.CurrentWeather(context.Background(), WeatherRequest{Lat: 41.99, Lon: 21.43, Units: "metric", Lang: "mk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WeatherInfo{FormatedTemp: "27.0 °C", Temperature: 27.04, Unit: "°C", Description: "clear sky", Icon: "01d", City: "Skopje"}
+	if info != want {
+		t.Fatalf("expected %+v, got %+v", want, info)
+	}
+	if query.Get("lat") != "41.99" || query.Get("lon") != "21.43" || query.Get("units") != "metric" || query.Get("lang") != "mk" || query.Get("appid") != "secret-key" {
+		t.Fatalf("unexpected query %v", query)
+	}
+
+	body = `{"main": {"temp": 80.6}, "name": "Nowhere"}`
+	info, err = provider.CurrentWeather(context.Background(), WeatherRequest{Units: "imperial"})
+	if err != nil || info.Description != "" || info.FormatedTemp != "80.6 °F" {
+		t.Fatalf("expected a response without weather entries to work, got %+v, %v", info, err)
+	}
+	if query.Has("lang") {
+		t.Fatalf("expected no lang parameter, got %v", query)
+	}
+
+	status, body = http.StatusUnauthorized, `{"cod": 401, "message": "Invalid API key"}`
+	_, err = provider.CurrentWeather(context.Background(), WeatherRequest{})
+	if !errors.Is(err, ErrWeatherUnavailable) || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Fatalf("expected ErrWeatherUnavailable with the upstream message, got %v", err)
+	}
+
+	status, body = http.StatusOK, "not json"
+	if _, err := provider.CurrentWeather(context.Background(), WeatherRequest{}); !errors.Is(err, ErrWeatherUnavailable) {
+		t.Fatalf("expected ErrWeatherUnavailable for a malformed body, got %v", err)
+	}
+
+	slow := NewOpenWeatherMap("secret-key", server.URL+"/slow", 50*time.Millisecond)
+	_, err = slow.CurrentWeather(context.Background(), WeatherRequest{})
+	if !errors.Is(err, ErrWeatherTimeout) || strings.Contains(err.Error(), "secret-key") {
+		t.Fatalf("expected ErrWeatherTimeout without the API key, got %v", err)
+	}
+
+	if _, err := NewOpenWeatherMap("", server.URL, time.Second).CurrentWeather(context.Background(), WeatherRequest{}); !errors.Is(err, ErrWeatherNotConfigured) {
+		t.Fatalf("expected ErrWeatherNotConfigured, got %v", err)
+	}
+}
+
+func TestParseWeatherRequest(t *testing.T) {
+	request, err := ParseWeatherRequest("41.99", "-21.5", "", "PT_BR")
+	want := WeatherRequest{Lat: 41.99, Lon: -21.5, Units: "metric", Lang: "pt_br"}
+	if err != nil || request != want {
+		t.Fatalf("expected %+v, got %+v, %v", want, request, err)
+	}
+
+	invalid := [][4]string{
+		{"", "21", "", ""},
+		{"91", "21", "", ""},
+		{"42", "abc", "", ""},
+		{"42", "-181", "", ""},
+		{"NaN", "nan", "", ""},
+		{"42", "NaN", "", ""},
+		{"42", "21", "kelvin", ""},
+		{"42", "21", "metric", "english"},
+	}
+	for _, params := range invalid {
+		if _, err := ParseWeatherRequest(params[0], params[1], params[2], params[3]); err == nil {
+			t.Fatalf("expected %v to be rejected", params)
+		}
+	}
+}
+
+type countingWeather struct {
+	calls    int
+	requests []WeatherRequest
+	err      error
+}
+
+func (c *countingWeather) CurrentWeather(ctx context.Context, request WeatherRequest) (WeatherInfo, error) {
+	c.calls++
+	c.requests = append(c.requests, request)
+	return WeatherInfo{City: "Skopje", Unit: weatherUnits[request.Units]}, c.err
+}
+
+func TestWeatherCache(t *testing.T) {
+	upstream := &countingWeather{}
+	cache := NewWeatherCache(upstream, time.Minute)
+	clock := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	cache.CurrentWeather(ctx, WeatherRequest{Lat: 41.9961, Lon: 21.4316, Units: "metric"})
+	info, err := cache.CurrentWeather(ctx, WeatherRequest{Lat: 41.9981, Lon: 21.4278, Units: "metric"})
+	if err != nil || info.City != "Skopje" {
+		t.Fatalf("unexpected answer %+v, %v", info, err)
+	}
+	if upstream.calls != 1 {
+		t.Fatalf("expected nearby positions to share an entry, got %d calls", upstream.calls)
+	}
+	if upstream.requests[0].Lat != 42 || upstream.requests[0].Lon != 21.43 {
+		t.Fatalf("expected the rounded position upstream, got %+v", upstream.requests[0])
+	}
+
+	cache.CurrentWeather(ctx, WeatherRequest{Lat: 41.9961, Lon: 21.4316, Units: "imperial"})
+	cache.CurrentWeather(ctx, WeatherRequest{Lat: 41.9961, Lon: 21.4316, Units: "metric", Lang: "mk"})
+	if upstream.calls != 3 {
+		t.Fatalf("expected units and lang to be part of the key, got %d calls", upstream.calls)
+	}
+
+	clock = clock.Add(time.Minute)
+	cache.CurrentWeather(ctx, WeatherRequest{Lat: 41.9961, Lon: 21.4316, Units: "metric"})
+	if upstream.calls != 4 {
+		t.Fatalf("expected an expired entry to be looked up again, got %d calls", upstream.calls)
+	}
+
+	upstream.err = ErrWeatherUnavailable
+	for i := 0; i < 2; i++ {
+		if _, err := cache.CurrentWeather(ctx, WeatherRequest{Lat: 10, Lon: 10, Units: "metric"}); !errors.Is(err, ErrWeatherUnavailable) {
+			t.Fatalf("expected the upstream error, got %v", err)
+		}
+	}
+	if upstream.calls != 6 {
+		t.Fatalf("expected failures not to be cached, got %d calls", upstream.calls)
+	}
+}
+
+func TestWeatherCacheIgnoresNaN(t *testing.T) {
+	cache := NewWeatherCache(&countingWeather{}, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		cache.CurrentWeather(ctx, WeatherRequest{Lat: math.NaN(), Lon: math.NaN(), Units: "metric"})
+	}
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected NaN positions not to be cached, got %d entries", len(cache.entries))
+	}
+
+	if _, err := ParseWeatherRequest("NaN", "nan", "", ""); err == nil {
+		t.Fatal("expected NaN positions to be rejected before they reach the cache")
+	}
+}
+
+func migrate(db *sql.DB) {
+	if err := migrations.Up(db); err != nil {
+		panic(err)
+	}
 }
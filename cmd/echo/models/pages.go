@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPageSize applies when a cursor is given without a limit.
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// PageQuery selects a page of tasks or lists. The zero value selects every
+// row ordered by id.
+type PageQuery struct {
+	// Limit is the page size, 0 for no limit.
+	Limit int
+	// Cursor is the next cursor returned with the previous page.
+	Cursor string
+	// Sort is id, name or created, with a leading "-" for descending order.
+	Sort string
+	// Search keeps rows whose name contains it, ignoring ASCII case.
+	Search string
+	// Completed filters tasks by their state; lists ignore it.
+	Completed *bool
+}
+
+// sortColumns maps sort names to SQL expressions. Timestamps are compared as
+// stored text, which sorts chronologically for the UTC values we write.
+var sortColumns = map[string]string{
+	"id":      "id",
+	"name":    "name",
+	"created": "CAST(created_at AS TEXT)",
+}
+
+// cursor is the position after the last row of a page. It is handed out
+// base64 encoded so clients treat it as opaque.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int    `json:"id"`
+}
+
+func (c cursor) encode() string {
+	body, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	c := cursor{}
+	body, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(body, &c)
+	}
+	if err != nil {
+		return c, &ValidationError{Field: "cursor", Message: "is invalid"}
+	}
+	return c, nil
+}
+
+// page holds the SQL a PageQuery adds to a SELECT with a WHERE clause. Its
+// placeholders are numbered after the arguments page was called with, which
+// args begins with.
+type page struct {
+	sort    string
+	column  string
+	where   string
+	args    []interface{}
+	orderBy string
+	limit   int
+}
+
+func (q PageQuery) page(args ...interface{}) (page, error) {
+	p := page{sort: q.Sort, limit: q.Limit, args: args}
+	if p.sort == "" {
+		p.sort = "id"
+	}
+
+	descending := strings.HasPrefix(p.sort, "-")
+	column, ok := sortColumns[strings.TrimPrefix(p.sort, "-")]
+	if !ok {
+		return p, &ValidationError{Field: "sort", Message: "must be id, name or created, optionally prefixed with -"}
+	}
+	p.column = column
+
+	if p.limit < 0 || p.limit > MaxPageSize {
+		return p, &ValidationError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxPageSize)}
+	}
+	if p.limit == 0 && q.Cursor != "" {
+		p.limit = DefaultPageSize
+	}
+
+	direction, compare := "ASC", ">"
+	if descending {
+		direction, compare = "DESC", "<"
+	}
+
+	if q.Search != "" {
+		p.where += " AND LOWER(name) LIKE LOWER(" + p.arg("%"+likeEscaper.Replace(q.Search)+"%") + `) ESCAPE '\'`
+	}
+	if q.Completed != nil {
+		p.where += " AND completed = " + p.arg(*q.Completed)
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return p, err
+		}
+		if after.Sort != p.sort {
+			return p, &ValidationError{Field: "cursor", Message: "was issued for another sort order"}
+		}
+		if column == "id" {
+			p.where += " AND id " + compare + " " + p.arg(after.ID)
+		} else {
+			p.where += fmt.Sprintf(" AND (%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND id %[2]s %[4]s))", column, compare, p.arg(after.Value), p.arg(after.ID))
+		}
+	}
+
+	p.orderBy = fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if column != "id" {
+		p.orderBy += ", id " + direction
+	}
+	if p.limit > 0 {
+		// one row more than asked for tells whether there is a next page
+		p.orderBy += " LIMIT " + strconv.Itoa(p.limit+1)
+	}
+	return p, nil
+}
+
+// arg adds a query argument and returns its placeholder.
+func (p *page) arg(value interface{}) string {
+	p.args = append(p.args, value)
+	return "$" + strconv.Itoa(len(p.args))
+}
+
+// next returns the cursor after the row with the given id and sort value.
+func (p page) next(id int, value string) string {
+	c := cursor{Sort: p.sort, ID: id}
+	if p.column != "id" {
+		c.Value = value
+	}
+	return c.encode()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// extraScanner scans the columns after the ones the wrapped scan asks for.
+type extraScanner struct {
+	row   scanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// QueryTasks returns a page of the tasks in a list and the cursor of the next
+// page, which is empty on the last page.
+func QueryTasks(ctx context.Context, db *sql.DB, listID int, q PageQuery) ([]Task, string, error) {
+	p, err := q.page(listID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := "SELECT " + taskColumns + ", " + p.column + " FROM tasks WHERE list_id = $1 AND deleted_at IS NULL" + p.where + p.orderBy
+	rows, err := db.QueryContext(ctx, query, p.args...)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("query tasks: %w", err)
+	}
+
+	defer rows.Close()
+
+	tasks := []Task{}
+	var value string
+	for rows.Next() {
+		if p.limit > 0 && len(tasks) == p.limit {
+			return tasks, p.next(tasks[len(tasks)-1].ID, value), nil
+		}
+		task, err := scanTask(extraScanner{rows, []interface{}{&value}})
+
+		if err != nil {
+			return nil, "", fmt.Errorf("scan task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("query tasks: %w", err)
+	}
+	return tasks, "", nil
+}
+
+// QueryLists returns a page of the lists of user and the cursor of the next
+// page, which is empty on the last page.
+func QueryLists(ctx context.Context, db *sql.DB, user User, q PageQuery) ([]List, string, error) {
+	q.Completed = nil
+	p, err := q.page(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := "SELECT " + listColumns + ", " + p.column + " FROM lists WHERE user_id = $1 AND deleted_at IS NULL" + p.where + p.orderBy
+	rows, err := db.QueryContext(ctx, query, p.args...)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("query lists: %w", err)
+	}
+
+	defer rows.Close()
+
+	lists := []List{}
+	var value string
+	for rows.Next() {
+		if p.limit > 0 && len(lists) == p.limit {
+			return lists, p.next(lists[len(lists)-1].ID, value), nil
+		}
+		list, err := scanList(extraScanner{rows, []interface{}{&value}})
+
+		if err != nil {
+			return nil, "", fmt.Errorf("scan list: %w", err)
+		}
+		lists = append(lists, list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("query lists: %w", err)
+	}
+	return lists, "", nil
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ListRepository stores the lists of every user. Ownership is checked by the
+// caller; Get, Rename and Delete act on any list. Lists in the trash are only
+// seen by Trash, Restore and Purge.
+type ListRepository interface {
+	Lists(ctx context.Context, user User, query PageQuery) ([]List, string, error)
+	Get(ctx context.Context, id int) (List, error)
+	Create(ctx context.Context, user User, name string) (List, error)
+	Rename(ctx context.Context, id int, name string) (List, error)
+	// Delete moves a list with its tasks to the trash and returns how many
+	// tasks went.
+	Delete(ctx context.Context, id int) (int, error)
+	OwnedBy(ctx context.Context, id int, user User) (bool, error)
+	Trash(ctx context.Context, user User) ([]List, error)
+	Restore(ctx context.Context, user User, id int) (List, error)
+	// Purge deletes the lists trashed before cutoff for good.
+	Purge(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// TaskRepository stores tasks together with the search index, exports and
+// imports over them. Like lists, trashed tasks are left out of everything but
+// Trash, Restore and Purge. The tasks of a trashed list stay as they are, but
+// OwnedBy, Search and Export treat them as trashed.
+type TaskRepository interface {
+	Tasks(ctx context.Context, listID int, query PageQuery) ([]Task, string, error)
+	Get(ctx context.Context, id int) (Task, error)
+	Create(ctx context.Context, listID int, task NewTask) (Task, error)
+	Update(ctx context.Context, id int, update TaskUpdate) (Task, error)
+	Delete(ctx context.Context, id int) error
+	OwnedBy(ctx context.Context, id int, user User) (bool, error)
+	Trash(ctx context.Context, user User) ([]Task, error)
+	Restore(ctx context.Context, user User, id int) (Task, error)
+	Purge(ctx context.Context, cutoff time.Time) (int, error)
+	Due(ctx context.Context, user User, query DueQuery) ([]Task, error)
+	// Reminders returns the reminders due by until that have not been
+	// marked as sent.
+	Reminders(ctx context.Context, until time.Time) ([]Reminder, error)
+	MarkReminded(ctx context.Context, id int) error
+	Search(ctx context.Context, user User, query string, limit int) ([]SearchResult, error)
+	Export(ctx context.Context, user User, w io.Writer, format ExportFormat, listID int) error
+	Import(ctx context.Context, user User, rows []ImportRow, dryRun bool) (ImportReport, error)
+}
+
+// UserRepository stores accounts and the revoked token ids.
+type UserRepository interface {
+	Create(ctx context.Context, username, password string) (User, error)
+	Get(ctx context.Context, id int) (User, error)
+	GetByUsername(ctx context.Context, username string) (User, error)
+	UpdatePassword(ctx context.Context, user User, password string) error
+	Delete(ctx context.Context, user User) error
+	// RevokeToken reports whether it revoked the token; false means another
+	// call did first.
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type Repositories struct {
+	Lists ListRepository
+	Tasks TaskRepository
+	Users UserRepository
+}
+
+// sqlitePragmas run on every new SQLite connection. SQLite ignores foreign
+// keys unless asked, WAL lets reads go on during a write, and busy_timeout has
+// a writer wait for the lock instead of failing with SQLITE_BUSY.
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"}
+
+// Open connects to the database named by dsn. A postgres:// or postgresql://
+// URL selects PostgreSQL, anything else is the path of a SQLite database.
+func Open(dsn string) (*sql.DB, Repositories, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, Repositories{}, err
+		}
+		return db, NewPostgresRepositories(db), nil
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", dsn+separator+url.Values{"_pragma": sqlitePragmas}.Encode())
+	if err != nil {
+		return nil, Repositories{}, err
+	}
+	return db, NewSQLiteRepositories(db), nil
+}
+
+// NewSQLiteRepositories stores everything with the functions of this package.
+// Their SQL is written for both SQLite and PostgreSQL; only search differs.
+func NewSQLiteRepositories(db *sql.DB) Repositories {
+	return Repositories{Lists: sqlLists{db}, Tasks: sqlTasks{db}, Users: sqlUsers{db}}
+}
+
+// NewPostgresRepositories is NewSQLiteRepositories with search on a tsvector
+// column in place of the FTS5 table.
+func NewPostgresRepositories(db *sql.DB) Repositories {
+	return Repositories{Lists: sqlLists{db}, Tasks: postgresTasks{sqlTasks{db}}, Users: sqlUsers{db}}
+}
+
+type sqlLists struct {
+	db *sql.DB
+}
+
+func (r sqlLists) Lists(ctx context.Context, user User, query PageQuery) ([]List, string, error) {
+	return QueryLists(ctx, r.db, user, query)
+}
+
+func (r sqlLists) Get(ctx context.Context, id int) (List, error) {
+	return GetList(ctx, r.db, id)
+}
+
+func (r sqlLists) Create(ctx context.Context, user User, name string) (List, error) {
+	id, err := CreateList(ctx, r.db, name, user)
+	if err != nil {
+		return List{}, err
+	}
+	return GetList(ctx, r.db, int(id))
+}
+
+func (r sqlLists) Rename(ctx context.Context, id int, name string) (List, error) {
+	return RenameList(ctx, r.db, id, name)
+}
+
+func (r sqlLists) Delete(ctx context.Context, id int) (int, error) {
+	return DeleteList(ctx, r.db, id)
+}
+
+func (r sqlLists) OwnedBy(ctx context.Context, id int, user User) (bool, error) {
+	return ListOwnedBy(ctx, r.db, id, user)
+}
+
+func (r sqlLists) Trash(ctx context.Context, user User) ([]List, error) {
+	return TrashedLists(ctx, r.db, user)
+}
+
+func (r sqlLists) Restore(ctx context.Context, user User, id int) (List, error) {
+	return RestoreList(ctx, r.db, user, id)
+}
+
+func (r sqlLists) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	return PurgeLists(ctx, r.db, cutoff)
+}
+
+type sqlTasks struct {
+	db *sql.DB
+}
+
+func (r sqlTasks) Tasks(ctx context.Context, listID int, query PageQuery) ([]Task, string, error) {
+	return QueryTasks(ctx, r.db, listID, query)
+}
+
+func (r sqlTasks) Get(ctx context.Context, id int) (Task, error) {
+	return GetTask(ctx, r.db, id)
+}
+
+func (r sqlTasks) Create(ctx context.Context, listID int, task NewTask) (Task, error) {
+	return CreateTask(ctx, r.db, task, listID)
+}
+
+func (r sqlTasks) Update(ctx context.Context, id int, update TaskUpdate) (Task, error) {
+	return UpdateTask(ctx, r.db, id, update)
+}
+
+func (r sqlTasks) Delete(ctx context.Context, id int) error {
+	_, err := DeleteTask(ctx, r.db, id)
+	return err
+}
+
+func (r sqlTasks) OwnedBy(ctx context.Context, id int, user User) (bool, error) {
+	return TaskOwnedBy(ctx, r.db, id, user)
+}
+
+func (r sqlTasks) Trash(ctx context.Context, user User) ([]Task, error) {
+	return TrashedTasks(ctx, r.db, user)
+}
+
+func (r sqlTasks) Restore(ctx context.Context, user User, id int) (Task, error) {
+	return RestoreTask(ctx, r.db, user, id)
+}
+
+func (r sqlTasks) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	return PurgeTasks(ctx, r.db, cutoff)
+}
+
+func (r sqlTasks) Due(ctx context.Context, user User, query DueQuery) ([]Task, error) {
+	return DueTasks(ctx, r.db, user, query)
+}
+
+func (r sqlTasks) Reminders(ctx context.Context, until time.Time) ([]Reminder, error) {
+	return DueReminders(ctx, r.db, until)
+}
+
+func (r sqlTasks) MarkReminded(ctx context.Context, id int) error {
+	return MarkReminded(ctx, r.db, id)
+}
+
+func (r sqlTasks) Search(ctx context.Context, user User, query string, limit int) ([]SearchResult, error) {
+	return SearchTasks(ctx, r.db, user, query, limit)
+}
+
+func (r sqlTasks) Export(ctx context.Context, user User, w io.Writer, format ExportFormat, listID int) error {
+	return ExportTasks(ctx, r.db, w, format, user, listID)
+}
+
+func (r sqlTasks) Import(ctx context.Context, user User, rows []ImportRow, dryRun bool) (ImportReport, error) {
+	return ImportTasks(ctx, r.db, user, rows, dryRun)
+}
+
+type postgresTasks struct {
+	sqlTasks
+}
+
+func (r postgresTasks) Search(ctx context.Context, user User, query string, limit int) ([]SearchResult, error) {
+	return searchTasksPostgres(ctx, r.db, user, query, limit)
+}
+
+type sqlUsers struct {
+	db *sql.DB
+}
+
+func (r sqlUsers) Create(ctx context.Context, username, password string) (User, error) {
+	return CreateUser(ctx, r.db, username, password)
+}
+
+func (r sqlUsers) Get(ctx context.Context, id int) (User, error) {
+	return GetUser(ctx, r.db, id)
+}
+
+func (r sqlUsers) GetByUsername(ctx context.Context, username string) (User, error) {
+	return GetUserByUsername(ctx, r.db, username)
+}
+
+func (r sqlUsers) UpdatePassword(ctx context.Context, user User, password string) error {
+	return UpdatePassword(ctx, r.db, user, password)
+}
+
+func (r sqlUsers) Delete(ctx context.Context, user User) error {
+	return DeleteUser(ctx, r.db, user)
+}
+
+func (r sqlUsers) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	return RevokeToken(ctx, r.db, jti, expiresAt)
+}
+
+func (r sqlUsers) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return IsTokenRevoked(ctx, r.db, jti)
+}
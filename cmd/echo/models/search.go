@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// SearchResult is a task matching a search together with the list it is in.
+type SearchResult struct {
+	Task     Task   `json:"task"`
+	ListID   int    `json:"listId"`
+	ListName string `json:"listName"`
+}
+
+// SearchTasks finds the tasks of user whose text contains every word of query,
+// each as a word prefix, best matches first.
+func SearchTasks(ctx context.Context, db *sql.DB, user User, query string, limit int) ([]SearchResult, error) {
+	limit, err := searchLimit(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+qualifiedTaskColumns+`, l.name
+		FROM task_search AS s
+		JOIN tasks AS t ON t.id = s.rowid
+		JOIN lists AS l ON l.id = t.list_id
+		WHERE task_search MATCH $1 AND l.user_id = $2 AND t.deleted_at IS NULL AND l.deleted_at IS NULL
+		ORDER BY s.rank, t.id
+		LIMIT $3`, searchExpression(query), user.ID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("search tasks: %w", err)
+	}
+	return scanSearchResults(rows)
+}
+
+// searchTasksPostgres is SearchTasks on the tsvector column PostgreSQL keeps
+// in place of the FTS5 table, ranked by ts_rank.
+func searchTasksPostgres(ctx context.Context, db *sql.DB, user User, query string, limit int) ([]SearchResult, error) {
+	limit, err := searchLimit(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+qualifiedTaskColumns+`, l.name
+		FROM tasks AS t
+		JOIN lists AS l ON l.id = t.list_id
+		CROSS JOIN to_tsquery('simple', $1) AS q
+		WHERE t.search @@ q AND l.user_id = $2 AND t.deleted_at IS NULL AND l.deleted_at IS NULL
+		ORDER BY ts_rank(t.search, q) DESC, t.id
+		LIMIT $3`, tsqueryExpression(query), user.ID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("search tasks: %w", err)
+	}
+	return scanSearchResults(rows)
+}
+
+// searchLimit validates a search and returns the limit to apply.
+func searchLimit(query string, limit int) (int, error) {
+	if strings.TrimSpace(query) == "" {
+		return 0, &ValidationError{Field: "q", Message: "must not be empty"}
+	}
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit < 1 || limit > MaxSearchLimit {
+		return 0, &ValidationError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxSearchLimit)}
+	}
+	return limit, nil
+}
+
+func scanSearchResults(rows *sql.Rows) ([]SearchResult, error) {
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		result := SearchResult{}
+		task, err := scanTask(extraScanner{rows, []interface{}{&result.ListName}})
+
+		if err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		result.Task = task
+		result.ListID = task.ListID
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("search tasks: %w", err)
+	}
+	return results, nil
+}
+
+// searchExpression turns user input into an FTS5 query. Every word is quoted
+// so operators and punctuation are matched literally rather than parsed.
+func searchExpression(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+var tsqueryEscaper = strings.NewReplacer(`'`, `''`, `\`, `\\`)
+
+// tsqueryExpression is searchExpression for PostgreSQL's to_tsquery: quoted
+// word prefixes that all have to match.
+func tsqueryExpression(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, "'"+tsqueryEscaper.Replace(word)+"':*")
+	}
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RevokeToken adds the token id jti to the revocation list and reports whether
+// this call put it there; false means it was revoked already. Entries are kept
+// until the token would have expired anyway; expired entries are purged here.
+func RevokeToken(ctx context.Context, db *sql.DB, jti string, expiresAt time.Time) (bool, error) {
+	if _, err := db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1", time.Now().Unix()); err != nil {
+		return false, fmt.Errorf("purge revoked tokens: %w", err)
+	}
+
+	result, err := db.ExecContext(ctx, "INSERT INTO revoked_tokens(jti, expires_at) VALUES($1,$2) ON CONFLICT DO NOTHING", jti, expiresAt.Unix())
+	if err != nil {
+		return false, fmt.Errorf("revoke token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("revoke token: %w", err)
+	}
+	return affected == 1, nil
+}
+
+func IsTokenRevoked(ctx context.Context, db *sql.DB, jti string) (bool, error) {
+	var revoked bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("query revoked tokens: %w", err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Trash holds the deleted lists and tasks of a user that can still be
+// restored, most recently deleted first. Tasks of a trashed list are not
+// listed on their own; they come back with their list.
+type Trash struct {
+	Lists []List `json:"lists"`
+	Tasks []Task `json:"tasks"`
+}
+
+func TrashedLists(ctx context.Context, db *sql.DB, user User) ([]List, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+listColumns+" FROM lists WHERE user_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC", user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("query trashed lists: %w", err)
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan list: %w", err)
+		}
+		lists = append(lists, list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query trashed lists: %w", err)
+	}
+	return lists, nil
+}
+
+func TrashedTasks(ctx context.Context, db *sql.DB, user User) ([]Task, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+taskColumns+` FROM tasks
+		WHERE deleted_at IS NOT NULL AND list_id IN (SELECT id FROM lists WHERE user_id = $1 AND deleted_at IS NULL)
+		ORDER BY deleted_at DESC, id DESC`, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("query trashed tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query trashed tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// RestoreList takes a list of user out of the trash. It fails with
+// ErrConflict when another list has taken its name in the meantime.
+func RestoreList(ctx context.Context, db *sql.DB, user User, id int) (List, error) {
+	list, err := scanList(db.QueryRowContext(ctx, "SELECT "+listColumns+" FROM lists WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL", id, user.ID))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return List{}, notFound("list", id)
+	}
+	if err != nil {
+		return List{}, fmt.Errorf("query list %d: %w", id, err)
+	}
+
+	if err := validateListName(ctx, db, list.Name, user.ID, id); err != nil {
+		return List{}, err
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE lists SET deleted_at = NULL WHERE id = $1", id); err != nil {
+		return List{}, fmt.Errorf("restore list %d: %w", id, err)
+	}
+
+	list.DeletedAt = nil
+	return list, nil
+}
+
+// RestoreTask takes a task of user out of the trash. A task of a trashed list
+// cannot be restored on its own.
+func RestoreTask(ctx context.Context, db *sql.DB, user User, id int) (Task, error) {
+	result, err := db.ExecContext(ctx, `UPDATE tasks SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND list_id IN (SELECT id FROM lists WHERE user_id = $2 AND deleted_at IS NULL)`, id, user.ID)
+
+	if err != nil {
+		return Task{}, fmt.Errorf("restore task %d: %w", id, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return Task{}, fmt.Errorf("restore task %d: %w", id, err)
+	}
+	if affected == 0 {
+		return Task{}, notFound("task", id)
+	}
+	return GetTask(ctx, db, id)
+}
+
+// PurgeLists deletes the lists trashed before cutoff for good, together with
+// all of their tasks, and returns how many lists went.
+func PurgeLists(ctx context.Context, db *sql.DB, cutoff time.Time) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("purge lists: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE list_id IN (SELECT id FROM lists WHERE deleted_at < $1)", cutoff); err != nil {
+		return 0, fmt.Errorf("purge tasks of lists: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("purge lists: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge lists: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("purge lists: %w", err)
+	}
+	return int(affected), nil
+}
+
+// PurgeTasks deletes the tasks trashed before cutoff for good and returns how
+// many went.
+func PurgeTasks(ctx context.Context, db *sql.DB, cutoff time.Time) (int, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM tasks WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("purge tasks: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge tasks: %w", err)
+	}
+	return int(affected), nil
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// PasswordCost is the bcrypt cost used for newly hashed passwords.
+var PasswordCost = 14
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past the 72nd byte
+	maxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return &ValidationError{Field: "username", Message: "must be 3 to 32 letters, digits, '.', '-' or '_'"}
+	}
+	return nil
+}
+
+func ValidatePassword(username, password string) error {
+	if len(password) < minPasswordLength {
+		return &ValidationError{Field: "password", Message: fmt.Sprintf("must be at least %d characters long", minPasswordLength)}
+	}
+	if len(password) > maxPasswordLength {
+		return &ValidationError{Field: "password", Message: fmt.Sprintf("must be at most %d bytes long", maxPasswordLength)}
+	}
+	if strings.EqualFold(password, username) {
+		return &ValidationError{Field: "password", Message: "must differ from the username"}
+	}
+	return nil
+}
+
+// CreateUser stores a new user with a bcrypt hash of password. It does not apply
+// the signup policy; callers accepting user input check ValidateUsername and
+// ValidatePassword first.
+func CreateUser(ctx context.Context, db *sql.DB, username, password string) (User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return User{}, fmt.Errorf("hash password: %w", err)
+	}
+
+	var id int
+	err = db.QueryRowContext(ctx, "INSERT INTO users(username, password) VALUES($1,$2) RETURNING id", username, string(hashedPassword)).Scan(&id)
+	if isUniqueViolation(err) {
+		return User{}, fmt.Errorf("username %q is taken: %w", username, ErrConflict)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("insert user: %w", err)
+	}
+
+	return User{ID: id, Username: username, Password: string(hashedPassword)}, nil
+}
+
+func GetUserByUsername(ctx context.Context, db *sql.DB, username string) (User, error) {
+	user, err := scanUser(db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", username))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("user %q %w", username, ErrNotFound)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("query user %q: %w", username, err)
+	}
+	return user, nil
+}
+
+func GetUser(ctx context.Context, db *sql.DB, id int) (User, error) {
+	user, err := scanUser(db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, notFound("user", id)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("query user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+// UpdatePassword stores a new password and records when, which invalidates
+// the tokens issued before.
+func UpdatePassword(ctx context.Context, db *sql.DB, user User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	result, err := db.ExecContext(ctx, "UPDATE users SET password = $1, password_changed_at = $2 WHERE id = $3", string(hashedPassword), now(), user.ID)
+	if err != nil {
+		return fmt.Errorf("update password of user %d: %w", user.ID, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update password of user %d: %w", user.ID, err)
+	}
+	if affected == 0 {
+		return notFound("user", user.ID)
+	}
+	return nil
+}
+
+// DeleteUser removes the user together with all of their lists and tasks.
+func DeleteUser(ctx context.Context, db *sql.DB, user User) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("delete user %d: %w", user.ID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE list_id IN (SELECT id FROM lists WHERE user_id = $1)", user.ID); err != nil {
+		return fmt.Errorf("delete tasks of user %d: %w", user.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM lists WHERE user_id = $1", user.ID); err != nil {
+		return fmt.Errorf("delete lists of user %d: %w", user.ID, err)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", user.ID)
+	if err != nil {
+		return fmt.Errorf("delete user %d: %w", user.ID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete user %d: %w", user.ID, err)
+	}
+	if affected == 0 {
+		return notFound("user", user.ID)
+	}
+
+	return tx.Commit()
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// isForeignKeyViolation tells whether err is a write that referenced a
+// missing row.
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// foreign keys are checked when the statement ends, and a statement
+		// with RETURNING then fails with the plain SQLITE_ERROR code
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY || strings.Contains(sqliteErr.Error(), "FOREIGN KEY constraint failed")
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23503"
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Weather struct {
+	Weather []struct {
+		Description string `json:"description"`
+		Icon        string `json:"icon"`
+	} `json:"weather,omitempty"`
+
+	Main struct {
+		Temp float64 `json:"temp"`
+	} `json:"main,omitempty"`
+
+	City string `json:"name,omitempty"`
+}
+
+type WeatherInfo struct {
+	FormatedTemp string  `json:"formatedTemp"`
+	Temperature  float64 `json:"temperature"`
+	Unit         string  `json:"unit"`
+	Description  string  `json:"description"`
+	// Icon is an OpenWeatherMap icon code such as "10d".
+	Icon string `json:"icon"`
+	City string `json:"city"`
+}
+
+// WeatherRequest asks for the weather at a position. Units is metric,
+// imperial or standard; Lang is a language code such as "en" or "pt_br", empty
+// for English.
+type WeatherRequest struct {
+	Lat   float64
+	Lon   float64
+	Units string
+	Lang  string
+}
+
+// weatherUnits maps the supported units to the unit of their temperatures.
+var weatherUnits = map[string]string{
+	"metric":   "°C",
+	"imperial": "°F",
+	"standard": "K",
+}
+
+var weatherLang = regexp.MustCompile(`^[a-z]{2}(_[a-z]{2})?$`)
+
+var (
+	ErrWeatherNotConfigured = errors.New("weather service is not configured")
+	ErrWeatherUnavailable   = errors.New("weather service is unavailable")
+	ErrWeatherTimeout       = errors.New("weather service timed out")
+)
+
+// WeatherProvider looks up the current weather at a position.
+type WeatherProvider interface {
+	CurrentWeather(ctx context.Context, request WeatherRequest) (WeatherInfo, error)
+}
+
+const (
+	DefaultWeatherURL     = "https://api.openweathermap.org/data/2.5"
+	DefaultWeatherTimeout = 5 * time.Second
+)
+
+// OpenWeatherMap is a WeatherProvider backed by the OpenWeatherMap current
+// weather API.
+type OpenWeatherMap struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewOpenWeatherMap returns a provider calling baseURL. Without an API key
+// every lookup fails with ErrWeatherNotConfigured.
+func NewOpenWeatherMap(apiKey, baseURL string, timeout time.Duration) *OpenWeatherMap {
+	return &OpenWeatherMap{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (o *OpenWeatherMap) CurrentWeather(ctx context.Context, request WeatherRequest) (WeatherInfo, error) {
+	if o.apiKey == "" {
+		return WeatherInfo{}, ErrWeatherNotConfigured
+	}
+	if request.Units == "" {
+		request.Units = "metric"
+	}
+
+	query := url.Values{
+		"lat":   {strconv.FormatFloat(request.Lat, 'f', -1, 64)},
+		"lon":   {strconv.FormatFloat(request.Lon, 'f', -1, 64)},
+		"units": {request.Units},
+		"appid": {o.apiKey},
+	}
+	if request.Lang != "" {
+		query.Set("lang", request.Lang)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/weather?"+query.Encode(), nil)
+	if err != nil {
+		return WeatherInfo{}, fmt.Errorf("%w: %v", ErrWeatherUnavailable, err)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		timeout := false
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			timeout = urlErr.Timeout()
+			// the URL of a *url.Error carries the API key
+			err = urlErr.Err
+		}
+		if timeout {
+			return WeatherInfo{}, fmt.Errorf("%w: %v", ErrWeatherTimeout, err)
+		}
+		return WeatherInfo{}, fmt.Errorf("%w: %v", ErrWeatherUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+		return WeatherInfo{}, fmt.Errorf("%w: status %d %s", ErrWeatherUnavailable, resp.StatusCode, failure.Message)
+	}
+
+	weather := Weather{}
+	if err := json.NewDecoder(resp.Body).Decode(&weather); err != nil {
+		return WeatherInfo{}, fmt.Errorf("%w: decode response: %v", ErrWeatherUnavailable, err)
+	}
+
+	unit := weatherUnits[request.Units]
+	info := WeatherInfo{
+		FormatedTemp: fmt.Sprintf("%.1f %s", weather.Main.Temp, unit),
+		Temperature:  weather.Main.Temp,
+		Unit:         unit,
+		City:         weather.City,
+	}
+	if len(weather.Weather) > 0 {
+		info.Description = weather.Weather[0].Description
+		info.Icon = weather.Weather[0].Icon
+	}
+	return info, nil
+}
+
+// ParseWeatherRequest validates a position and the optional units (metric by
+// default) and lang given as text.
+func ParseWeatherRequest(lat, lon, units, lang string) (WeatherRequest, error) {
+	latitude, err := strconv.ParseFloat(lat, 64)
+	// ParseFloat accepts NaN, which passes any range check
+	if err != nil || math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return WeatherRequest{}, &ValidationError{Field: "lat", Message: "must be a number between -90 and 90"}
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil || math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return WeatherRequest{}, &ValidationError{Field: "lon", Message: "must be a number between -180 and 180"}
+	}
+
+	if units == "" {
+		units = "metric"
+	}
+	if _, ok := weatherUnits[units]; !ok {
+		return WeatherRequest{}, &ValidationError{Field: "units", Message: "must be metric, imperial or standard"}
+	}
+	lang = strings.ToLower(lang)
+	if lang != "" && !weatherLang.MatchString(lang) {
+		return WeatherRequest{}, &ValidationError{Field: "lang", Message: "must be a language code such as en or pt_br"}
+	}
+
+	return WeatherRequest{Lat: latitude, Lon: longitude, Units: units, Lang: lang}, nil
+}
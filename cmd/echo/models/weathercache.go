@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// weatherPrecision is the number of decimals positions are rounded to before
+// they are looked up, about a kilometre.
+const weatherPrecision = 2
+
+// WeatherCache is a WeatherProvider remembering the answers of another one for
+// a while. Nearby positions share an entry, so a dashboard polling from one
+// place costs one upstream call per ttl. Failed lookups are not cached.
+type WeatherCache struct {
+	provider WeatherProvider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[WeatherRequest]cachedWeather
+}
+
+type cachedWeather struct {
+	info    WeatherInfo
+	expires time.Time
+}
+
+func NewWeatherCache(provider WeatherProvider, ttl time.Duration) *WeatherCache {
+	return &WeatherCache{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  map[WeatherRequest]cachedWeather{},
+	}
+}
+
+func (wc *WeatherCache) CurrentWeather(ctx context.Context, request WeatherRequest) (WeatherInfo, error) {
+	request.Lat = roundCoordinate(request.Lat)
+	request.Lon = roundCoordinate(request.Lon)
+	// NaN never equals itself, so such an entry could neither be found nor
+	// evicted; ParseWeatherRequest rejects NaN, this guards other callers
+	if math.IsNaN(request.Lat) || math.IsNaN(request.Lon) {
+		return wc.provider.CurrentWeather(ctx, request)
+	}
+
+	if info, ok := wc.get(request); ok {
+		return info, nil
+	}
+
+	info, err := wc.provider.CurrentWeather(ctx, request)
+	if err != nil {
+		return WeatherInfo{}, err
+	}
+	wc.put(request, info)
+	return info, nil
+}
+
+func (wc *WeatherCache) get(request WeatherRequest) (WeatherInfo, bool) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	entry, ok := wc.entries[request]
+	if !ok {
+		return WeatherInfo{}, false
+	}
+	if !wc.now().Before(entry.expires) {
+		delete(wc.entries, request)
+		return WeatherInfo{}, false
+	}
+	return entry.info, true
+}
+
+func (wc *WeatherCache) put(request WeatherRequest, info WeatherInfo) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	now := wc.now()
+	for key, entry := range wc.entries {
+		if !now.Before(entry.expires) {
+			delete(wc.entries, key)
+		}
+	}
+
+	wc.entries[request] = cachedWeather{info: info, expires: now.Add(wc.ttl)}
+}
+
+func roundCoordinate(value float64) float64 {
+	scale := math.Pow(10, weatherPrecision)
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"final/cmd/api"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handle adapts a handler returning an error, the way echo handlers do, to
+// gin. The error is answered by ErrorHandler.
+func handle(h func(c *gin.Context) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := h(c); err != nil {
+			c.Error(err)
+			c.Abort()
+		}
+	}
+}
+
+// ErrorHandler answers the last error of a request with the same JSON body
+// and status as the echo server does.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil || c.Writer.Written() {
+			return
+		}
+
+		response := api.Error(last.Err)
+		if response.Code >= http.StatusInternalServerError {
+			log.Println(last.Err)
+		}
+
+		// gin keeps a Content-Type set by the failed handler, e.g. of an export
+		c.Writer.Header().Del("Content-Type")
+		if c.Request.Method == http.MethodHead {
+			c.Status(response.Code)
+			return
+		}
+		c.JSON(response.Code, response)
+	}
+}
+
+// bind decodes the JSON body of a request into v like echo's Bind does: an
+// empty body leaves v alone and other content types are not supported.
+func bind(c *gin.Context, v interface{}) error {
+	if c.Request.ContentLength == 0 {
+		return nil
+	}
+	if !strings.HasPrefix(c.GetHeader("Content-Type"), "application/json") {
+		return api.ErrUnsupportedMedia
+	}
+
+	err := json.NewDecoder(c.Request.Body).Decode(v)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntaxErr):
+		return &api.StatusError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Syntax error: offset=%v, error=%v", syntaxErr.Offset, syntaxErr.Error())}
+	case errors.As(err, &typeErr):
+		return &api.StatusError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Unmarshal type error: expected=%v, got=%v, field=%v, offset=%v", typeErr.Type, typeErr.Value, typeErr.Field, typeErr.Offset)}
+	default:
+		return &api.StatusError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+}
@@ -0,0 +1,402 @@
+// Package handlers serves the to-do API with gin. It mirrors the echo
+// handlers in cmd/echo/handlers route for route; the contract tests in
+// cmd/contract check that both answer alike.
+package handlers
+
+import (
+	"errors"
+	"final/cmd/api"
+	"final/cmd/echo/models"
+	"final/cmd/service"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userKey is the gin.Context key holding the authenticated models.User of a request.
+const userKey = "user"
+
+func SetUser(c *gin.Context, user models.User) {
+	c.Set(userKey, user)
+}
+
+func CurrentUser(c *gin.Context) models.User {
+	user, _ := c.Keys[userKey].(models.User)
+	return user
+}
+
+func paramID(c *gin.Context) (int, error) {
+	return api.ParseID("id", c.Param("id"))
+}
+
+func GetTasks(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		listID, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		query, err := api.ParseTaskQuery(c.Request.URL.Query())
+		if err != nil {
+			return err
+		}
+
+		tasks, next, err := todos.Tasks(c.Request.Context(), CurrentUser(c), listID, query)
+		if err != nil {
+			return err
+		}
+		setNextPage(c, next)
+		c.JSON(http.StatusOK, tasks)
+		return nil
+	})
+}
+
+// setNextPage points the client to the next page with a Link header and the
+// bare cursor in X-Next-Cursor. The body stays a plain JSON array.
+func setNextPage(c *gin.Context, next string) {
+	if next == "" {
+		return
+	}
+	c.Header("Link", api.NextPageLink(*c.Request.URL, next))
+	c.Header("X-Next-Cursor", next)
+}
+
+func GetTask(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		task, err := todos.Task(c.Request.Context(), CurrentUser(c), id)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, task)
+		return nil
+	})
+}
+
+func CreateTask(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		task := models.NewTask{}
+		if err := bind(c, &task); err != nil {
+			return err
+		}
+		listID, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		myTask, err := todos.CreateTask(c.Request.Context(), CurrentUser(c), listID, task)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, myTask)
+		return nil
+	})
+}
+
+func UpdateTask(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		var update models.TaskUpdate
+		if err := bind(c, &update); err != nil {
+			return err
+		}
+
+		task, err := todos.UpdateTask(c.Request.Context(), CurrentUser(c), id, update)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, task)
+		return nil
+	})
+}
+
+func DeleteTask(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		if err := todos.DeleteTask(c.Request.Context(), CurrentUser(c), id); err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"deleted": id,
+		})
+		return nil
+	})
+}
+
+// ExportTasks streams the current user's tasks as a download. The format query
+// parameter picks csv (default), json, markdown or ical, and list restricts the
+// export to one list.
+func ExportTasks(exports service.ExportService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		format, err := api.ExportFormat(c.Query("format"))
+		if err != nil {
+			return err
+		}
+
+		listID := 0
+		if param := c.Query("list"); param != "" {
+			listID, err = api.ParseID("list", param)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.Header("Content-Type", format.ContentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "tasks."+format.Extension))
+
+		err = exports.Export(c.Request.Context(), CurrentUser(c), c.Writer, format, listID)
+		if err != nil && !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+		}
+		return err
+	})
+}
+
+// SearchTasks finds the current user's tasks matching the q query parameter
+// in all of their lists, best matches first.
+func SearchTasks(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		limit, err := api.ParseSearchLimit(c.Query("limit"))
+		if err != nil {
+			return err
+		}
+
+		results, err := todos.Search(c.Request.Context(), CurrentUser(c), c.Query("q"), limit)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, results)
+		return nil
+	})
+}
+
+// DueTasks lists the current user's tasks due today, in the next week or
+// overdue, across all of their lists, soonest first.
+func DueTasks(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		query, err := api.ParseDueQuery(c.Request.URL.Query())
+		if err != nil {
+			return err
+		}
+
+		tasks, err := todos.DueTasks(c.Request.Context(), CurrentUser(c), query)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, tasks)
+		return nil
+	})
+}
+
+// ImportTasks creates lists and tasks from a csv or json file in the export
+// format. With dryRun=true nothing is stored and the report says what would
+// have been created. Any invalid row rejects the whole import.
+func ImportTasks(exports service.ExportService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		format, err := api.ImportFormat(c.Query("format"), c.GetHeader("Content-Type"))
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := api.ParseBool("dryRun", c.Query("dryRun"))
+		if err != nil {
+			return err
+		}
+
+		body := api.NewImportBody(c.Writer, c.Request.Body)
+		report, err := exports.Import(c.Request.Context(), CurrentUser(c), body, format, dryRun)
+		if body.TooLarge() {
+			return api.ErrTooLarge
+		}
+		if errors.Is(err, service.ErrImportRejected) {
+			c.JSON(http.StatusBadRequest, report)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			c.JSON(http.StatusOK, report)
+			return nil
+		}
+		c.JSON(http.StatusCreated, report)
+		return nil
+	})
+}
+
+func GetLists(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		query, err := api.ParsePageQuery(c.Request.URL.Query())
+		if err != nil {
+			return err
+		}
+
+		lists, next, err := todos.Lists(c.Request.Context(), CurrentUser(c), query)
+		if err != nil {
+			return err
+		}
+		setNextPage(c, next)
+		c.JSON(http.StatusOK, lists)
+		return nil
+	})
+}
+
+func CreateList(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		var list models.List
+		if err := bind(c, &list); err != nil {
+			return err
+		}
+
+		created, err := todos.CreateList(c.Request.Context(), CurrentUser(c), list.Name)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":   created.ID,
+			"name": created.Name,
+		})
+		return nil
+	})
+}
+
+func GetList(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		list, err := todos.List(c.Request.Context(), CurrentUser(c), id)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, list)
+		return nil
+	})
+}
+
+// UpdateList renames a list. It serves both PUT and PATCH, as name is the only
+// editable field.
+func UpdateList(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		var list models.List
+		if err := bind(c, &list); err != nil {
+			return err
+		}
+
+		renamed, err := todos.RenameList(c.Request.Context(), CurrentUser(c), id, list.Name)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, renamed)
+		return nil
+	})
+}
+
+func DeleteList(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		tasks, err := todos.DeleteList(c.Request.Context(), CurrentUser(c), id)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"deleted":      id,
+			"tasksDeleted": tasks,
+		})
+		return nil
+	})
+}
+
+func GetTrash(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		trash, err := todos.Trash(c.Request.Context(), CurrentUser(c))
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, trash)
+		return nil
+	})
+}
+
+func RestoreList(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		list, err := todos.RestoreList(c.Request.Context(), CurrentUser(c), id)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, list)
+		return nil
+	})
+}
+
+func RestoreTask(todos service.TodoService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		id, err := paramID(c)
+		if err != nil {
+			return err
+		}
+
+		task, err := todos.RestoreTask(c.Request.Context(), CurrentUser(c), id)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, task)
+		return nil
+	})
+}
+
+// GetWeather reports the weather at the position in the lat and lon headers,
+// or query parameters of the same name. The units and lang query parameters
+// choose the temperature unit and the language of the description.
+func GetWeather(weather models.WeatherProvider) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		lat := c.GetHeader("lat")
+		if lat == "" {
+			lat = c.Query("lat")
+		}
+		lon := c.GetHeader("lon")
+		if lon == "" {
+			lon = c.Query("lon")
+		}
+		request, err := models.ParseWeatherRequest(lat, lon, c.Query("units"), c.Query("lang"))
+		if err != nil {
+			return err
+		}
+
+		info, err := weather.CurrentWeather(c.Request.Context(), request)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, info)
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"final/cmd/api"
+	"final/cmd/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenKey is the gin.Context key holding the *api.TokenClaims of a Bearer request.
+const tokenKey = "token"
+
+// Authenticate accepts either an "Authorization: Bearer" access token or Basic
+// credentials, and stores the matching user on the context.
+func Authenticate(users service.UserService, tokens *api.TokenIssuer) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		if token, ok := api.BearerToken(c.GetHeader("Authorization")); ok {
+			claims, user, err := api.VerifyToken(c.Request.Context(), users, tokens, token, api.AccessToken)
+			if err != nil {
+				c.Header("WWW-Authenticate", "Bearer")
+				return err
+			}
+
+			SetUser(c, user)
+			c.Set(tokenKey, claims)
+			return nil
+		}
+
+		username, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", "basic realm=Restricted")
+			return api.ErrUnauthorized
+		}
+		user, ok, err := users.Authenticate(c.Request.Context(), username, password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.Header("WWW-Authenticate", "basic realm=Restricted")
+			return api.ErrUnauthorized
+		}
+
+		SetUser(c, user)
+		return nil
+	})
+}
+
+func Login(users service.UserService, tokens *api.TokenIssuer) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		var request api.CredentialsRequest
+		if err := bind(c, &request); err != nil {
+			return err
+		}
+
+		user, ok, err := users.Authenticate(c.Request.Context(), request.Username, request.Password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return api.ErrInvalidCredentials
+		}
+
+		pair, err := tokens.Issue(user)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, pair)
+		return nil
+	})
+}
+
+// RefreshToken trades a refresh token for a new token pair. The presented
+// refresh token is revoked, so each one can be used only once.
+func RefreshToken(users service.UserService, tokens *api.TokenIssuer) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		var request api.RefreshRequest
+		if err := bind(c, &request); err != nil {
+			return err
+		}
+
+		claims, user, err := api.VerifyToken(c.Request.Context(), users, tokens, request.RefreshToken, api.RefreshToken)
+		if err != nil {
+			return err
+		}
+		if err := api.RedeemToken(c.Request.Context(), users, claims); err != nil {
+			return err
+		}
+
+		pair, err := tokens.Issue(user)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, pair)
+		return nil
+	})
+}
+
+// Logout revokes the access token of the request and, when given, the refresh
+// token in the body.
+func Logout(users service.UserService, tokens *api.TokenIssuer) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		var request api.RefreshRequest
+		if err := bind(c, &request); err != nil {
+			return err
+		}
+
+		if claims, ok := c.Keys[tokenKey].(*api.TokenClaims); ok {
+			if err := api.RevokeToken(c.Request.Context(), users, claims); err != nil {
+				return err
+			}
+		}
+
+		if request.RefreshToken != "" {
+			if err := api.RevokeRefreshToken(c.Request.Context(), users, tokens, request.RefreshToken, CurrentUser(c)); err != nil {
+				return err
+			}
+		}
+
+		c.Status(http.StatusNoContent)
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"final/cmd/api"
+	"final/cmd/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUser is the signup endpoint. It is registered outside the
+// authenticated /api group.
+func CreateUser(users service.UserService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		var request api.CredentialsRequest
+		if err := bind(c, &request); err != nil {
+			return err
+		}
+
+		user, err := users.SignUp(c.Request.Context(), request.Username, request.Password)
+		if err != nil {
+			return err
+		}
+		c.JSON(http.StatusCreated, user)
+		return nil
+	})
+}
+
+func ChangePassword(users service.UserService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		var request api.PasswordChangeRequest
+		if err := bind(c, &request); err != nil {
+			return err
+		}
+
+		err := users.ChangePassword(c.Request.Context(), CurrentUser(c), request.CurrentPassword, request.NewPassword)
+		if err != nil {
+			return err
+		}
+		c.Status(http.StatusNoContent)
+		return nil
+	})
+}
+
+func DeleteUser(users service.UserService) gin.HandlerFunc {
+	return handle(func(c *gin.Context) error {
+		user := CurrentUser(c)
+
+		if err := users.Delete(c.Request.Context(), user); err != nil {
+			return err
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"deleted": user.ID,
+		})
+		return nil
+	})
+}
@@ -2,26 +2,25 @@ package main
 
 import (
 	"final/cmd"
+	"final/cmd/gin/handlers"
 	"log"
 	"net/http"
 
-	"github.com/gin-gonic/gin"
+	// the tz parameter of the due views needs the time zone database even
+	// on hosts without zoneinfo, such as scratch containers
+	_ "time/tzdata"
 )
 
-func main() {
-
-	router := gin.Default()
+//start the app with go run cmd/gin/main.go
 
-	router.Use(func(ctx *gin.Context) {
-		// This is a sample demonstration of how to attach middlewares in Gin
-		log.Println("Gin middleware was called")
-		ctx.Next()
-	})
+func main() {
+	app, ok := cmd.Setup()
+	if !ok {
+		return
+	}
 
-	// Add your handler (API endpoint) registrations here
-	router.GET("/api", func(ctx *gin.Context) {
-		ctx.JSON(200, "Hello, World!")
-	})
+	router := app.Track(handlers.NewRouter(app.API))
+	app.Start()
 
 	// Do not touch this line!
 	log.Fatal(http.ListenAndServe(":3000", cmd.CreateCommonMux(router)))
@@ -0,0 +1,66 @@
+// Package testdb sets up migrated in-memory databases and sample data for the
+// tests of the other packages. Importing it lowers models.PasswordCost so the
+// tests do not spend their time hashing passwords.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"final/cmd/echo/migrations"
+	"final/cmd/echo/models"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
+)
+
+// New opens a migrated SQLite :memory: database which is closed when t ends.
+func New(t testing.TB) (*sql.DB, models.Repositories) {
+	t.Helper()
+	db, repos, err := models.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every pooled connection would get its own empty :memory: database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	return db, repos
+}
+
+// CreateUser signs up username in repos.
+func CreateUser(t testing.TB, repos models.Repositories, username, password string) models.User {
+	t.Helper()
+	user, err := repos.Users.Create(context.Background(), username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// CreateList adds a list named name for user to repos.
+func CreateList(t testing.TB, repos models.Repositories, user models.User, name string) models.List {
+	t.Helper()
+	list, err := repos.Lists.Create(context.Background(), user, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// CreateTask adds a task with text to the list listID in repos.
+func CreateTask(t testing.TB, repos models.Repositories, listID int, text string) models.Task {
+	t.Helper()
+	task, err := repos.Tasks.Create(context.Background(), listID, models.NewTask{Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func init() {
+	models.PasswordCost = bcrypt.MinCost
+}
@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"final/cmd/api"
+	"final/cmd/echo/config"
+	"final/cmd/echo/migrations"
+	"final/cmd/echo/models"
+	"final/cmd/service"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// App is the state both servers set up before they build their router.
+type App struct {
+	Config config.Config
+	// DB is nil with -store=memory.
+	DB        *sql.DB
+	API       api.Dependencies
+	Trash     *service.TrashPurger
+	Reminders *service.ReminderScheduler
+
+	requests *inFlight
+}
+
+// Setup loads the configuration, opens, migrates and seeds the database and
+// builds the handler dependencies. It returns false when the process has
+// nothing left to do, e.g. after -help, -print-config or -migrate=status.
+func Setup() (*App, bool) {
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.PrintConfig {
+		fmt.Print(cfg)
+		return nil, false
+	}
+	log.Printf("configuration:\n%s", cfg)
+
+	models.PasswordCost = cfg.BcryptCost
+
+	var db *sql.DB
+	var repos models.Repositories
+	if cfg.Store == "memory" {
+		log.Println("keeping all data in memory, it is lost when the server stops")
+		repos = models.NewMemoryRepositories()
+	} else {
+		db, repos = initDB(cfg.DBPath)
+		switch cfg.Migrate {
+		case "up":
+			if err := migrations.Up(db); err != nil {
+				log.Fatal(err)
+			}
+		case "down":
+			if err := migrations.Down(db, cfg.MigrateSteps); err != nil {
+				log.Fatal(err)
+			}
+			printMigrationStatus(db)
+			return nil, false
+		case "status":
+			printMigrationStatus(db)
+			return nil, false
+		}
+	}
+
+	if cfg.Seed {
+		for _, user := range cfg.SeedUsers {
+			if err := seedUser(repos.Users, user.Username, user.Password); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if cfg.Weather.APIKey == "" {
+		log.Println("no OpenWeatherMap API key is configured, /api/weather will answer 503")
+	}
+	openWeatherMap := models.NewOpenWeatherMap(cfg.Weather.APIKey, cfg.Weather.URL, cfg.Weather.Timeout)
+
+	var notifier service.Notifier = service.LogNotifier{}
+	if cfg.Reminders.WebhookURL != "" {
+		notifier = service.NewWebhookNotifier(cfg.Reminders.WebhookURL, cfg.Reminders.WebhookTimeout)
+	}
+
+	app := &App{
+		Config: cfg,
+		DB:     db,
+		API: api.NewDependencies(
+			repos,
+			api.NewTokenIssuer(jwtSecret(cfg.JWTSecret), cfg.AccessTokenTTL, cfg.RefreshTokenTTL),
+			service.NewCredentialCache(cfg.CredentialCacheTTL),
+			models.NewWeatherCache(openWeatherMap, cfg.Weather.CacheTTL),
+		),
+		Trash:     service.NewTrashPurger(repos, cfg.TrashRetention),
+		Reminders: service.NewReminderScheduler(repos, notifier),
+		requests:  newInFlight(),
+	}
+	RegisterReadinessCheck(app.DatabaseCheck())
+	RegisterReadinessCheck(app.ShutdownCheck())
+	return app, true
+}
+
+// Track counts the requests h is serving, so that a shutdown can wait for
+// them. Once the shutdown has begun, new requests are answered with 503.
+func (a *App) Track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.requests.start() {
+			w.Header().Set("Connection", "close")
+			writeStatus(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"code":    http.StatusServiceUnavailable,
+				"message": "shutting down",
+			})
+			return
+		}
+		defer a.requests.done()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Start runs the trash purge and the reminders in the background. On SIGINT
+// or SIGTERM it fails /readyz, waits up to the shutdown timeout for the
+// requests Track counts, closes the database and exits the process.
+func (a *App) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		runEvery(ctx, a.Config.TrashPurgeInterval, a.purgeTrash)
+	}()
+	go func() {
+		defer background.Done()
+		runEvery(ctx, a.Config.Reminders.Interval, a.sendReminders)
+	}()
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals.Done()
+		// a second signal kills the process right away
+		stop()
+
+		a.drain(a.Config.ShutdownTimeout)
+		// a purge or reminder still running needs the database
+		cancel()
+		background.Wait()
+		if a.DB != nil {
+			if err := a.DB.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		log.Println("stopped")
+		os.Exit(0)
+	}()
+}
+
+// drain stops taking requests and waits up to timeout for the ones in flight.
+func (a *App) drain(timeout time.Duration) {
+	log.Printf("shutting down, waiting up to %s for requests to finish", timeout)
+	select {
+	case <-a.requests.drain():
+	case <-time.After(timeout):
+		log.Printf("%d requests still running after %s", a.requests.count(), timeout)
+	}
+}
+
+// ShutdownCheck makes /readyz fail once the shutdown has begun, so that
+// traffic is sent elsewhere while the last requests finish.
+func (a *App) ShutdownCheck() ReadinessCheck {
+	return ReadinessCheck{
+		Name: "shutdown",
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			if a.requests.draining() {
+				return nil, errors.New("shutting down")
+			}
+			return nil, nil
+		},
+	}
+}
+
+// inFlight counts running requests. Once draining, it takes no new ones and
+// closes idle when the last one is done.
+type inFlight struct {
+	mu       sync.Mutex
+	requests int
+	stopping bool
+	idle     chan struct{}
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{idle: make(chan struct{})}
+}
+
+// start counts a new request, or reports false when draining.
+func (f *inFlight) start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopping {
+		return false
+	}
+	f.requests++
+	return true
+}
+
+func (f *inFlight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests--
+	if f.stopping && f.requests == 0 {
+		close(f.idle)
+	}
+}
+
+// drain stops taking requests. The channel is closed once none are running.
+func (f *inFlight) drain() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.stopping {
+		f.stopping = true
+		if f.requests == 0 {
+			close(f.idle)
+		}
+	}
+	return f.idle
+}
+
+func (f *inFlight) draining() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopping
+}
+
+func (f *inFlight) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// DatabaseCheck makes /readyz ping the database and report its schema version.
+// The server is not ready while migrations are pending. The memory store is
+// always ready.
+func (a *App) DatabaseCheck() ReadinessCheck {
+	return ReadinessCheck{
+		Name: "database",
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			if a.DB == nil {
+				return map[string]interface{}{"store": "memory"}, nil
+			}
+			if err := a.DB.PingContext(ctx); err != nil {
+				return nil, err
+			}
+
+			status, err := migrations.ReadStatus(ctx, a.DB)
+			if err != nil {
+				return nil, err
+			}
+			details := map[string]interface{}{"schemaVersion": status.Current, "latestSchemaVersion": status.Latest}
+			if len(status.Pending) > 0 {
+				return details, fmt.Errorf("%d migrations pending", len(status.Pending))
+			}
+			return details, nil
+		},
+	}
+}
+
+// initDB opens the SQLite database at dsn, or PostgreSQL for a postgres:// URL.
+func initDB(dsn string) (*sql.DB, models.Repositories) {
+	db, repos, err := models.Open(dsn)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if db == nil {
+		panic("db nil")
+	}
+	return db, repos
+}
+
+// seedUser creates a demo account. Existing accounts are left untouched.
+func seedUser(users models.UserRepository, username, password string) error {
+	ctx := context.Background()
+	if _, err := users.GetByUsername(ctx, username); err == nil {
+		return nil
+	} else if !errors.Is(err, models.ErrNotFound) {
+		return err
+	}
+
+	_, err := users.Create(ctx, username, password)
+	return err
+}
+
+// runEvery calls fn right away and then every interval until ctx is done.
+func runEvery(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) purgeTrash(ctx context.Context) {
+	lists, tasks, err := a.Trash.Purge(ctx)
+	if err != nil {
+		log.Printf("purge trash: %v", err)
+	} else if lists > 0 || tasks > 0 {
+		log.Printf("purged %d lists and %d tasks from the trash", lists, tasks)
+	}
+}
+
+func (a *App) sendReminders(ctx context.Context) {
+	sent, err := a.Reminders.Send(ctx)
+	if err != nil {
+		log.Printf("send reminders: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("sent %d reminders", sent)
+	}
+}
+
+func printMigrationStatus(db *sql.DB) {
+	status, err := migrations.GetStatus(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("schema version %d of %d\n", status.Current, status.Latest)
+	for _, m := range status.Pending {
+		fmt.Printf("pending: %04d_%s\n", m.Version, m.Name)
+	}
+}
+
+// jwtSecret returns the configured token signing key. Without one a random
+// key is used and all issued tokens become invalid on restart.
+func jwtSecret(configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+
+	log.Println("no JWT secret is configured, using a random token signing key")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal(err)
+	}
+	return secret
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrackDrainsRequests(t *testing.T) {
+	app := &App{requests: newInFlight()}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := app.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	finished := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/lists", nil))
+		finished <- rec.Code
+	}()
+	<-started
+
+	check := app.ShutdownCheck()
+	if _, err := check.Check(context.Background()); err != nil {
+		t.Fatalf("expected the server to be ready before the shutdown, got %v", err)
+	}
+
+	idle := app.requests.drain()
+	if _, err := check.Check(context.Background()); err == nil {
+		t.Fatal("expected the shutdown to fail the readiness check")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/lists", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected new requests to be refused while draining, got %d", rec.Code)
+	}
+
+	select {
+	case <-idle:
+		t.Fatal("expected the drain to wait for the running request")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if code := <-finished; code != http.StatusNoContent {
+		t.Fatalf("expected the running request to finish, got %d", code)
+	}
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("expected the drain to end with the last request")
+	}
+}
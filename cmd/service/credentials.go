@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"final/cmd/echo/models"
+	"sync"
+	"time"
+)
+
+// CredentialCache remembers recently verified username/password pairs, so a
+// client polling the API does not pay for a bcrypt comparison on every call.
+// Passwords are only kept as an HMAC under a per-process random key.
+// A nil *CredentialCache is valid and caches nothing.
+type CredentialCache struct {
+	ttl time.Duration
+	key []byte
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedCredential
+}
+
+type cachedCredential struct {
+	mac     []byte
+	user    models.User
+	expires time.Time
+}
+
+func NewCredentialCache(ttl time.Duration) *CredentialCache {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	return &CredentialCache{
+		ttl:     ttl,
+		key:     key,
+		now:     time.Now,
+		entries: map[string]cachedCredential{},
+	}
+}
+
+func (cc *CredentialCache) Get(username, password string) (models.User, bool) {
+	if cc == nil {
+		return models.User{}, false
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry, ok := cc.entries[username]
+	if !ok {
+		return models.User{}, false
+	}
+	if !cc.now().Before(entry.expires) {
+		delete(cc.entries, username)
+		return models.User{}, false
+	}
+	if !hmac.Equal(entry.mac, cc.mac(password)) {
+		return models.User{}, false
+	}
+	return entry.user, true
+}
+
+func (cc *CredentialCache) Put(username, password string, user models.User) {
+	if cc == nil {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	now := cc.now()
+	for name, entry := range cc.entries {
+		if !now.Before(entry.expires) {
+			delete(cc.entries, name)
+		}
+	}
+
+	cc.entries[username] = cachedCredential{
+		mac:     cc.mac(password),
+		user:    user,
+		expires: now.Add(cc.ttl),
+	}
+}
+
+// Forget drops the cached credentials of username, e.g. after a password change.
+func (cc *CredentialCache) Forget(username string) {
+	if cc == nil {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	delete(cc.entries, username)
+}
+
+func (cc *CredentialCache) mac(password string) []byte {
+	h := hmac.New(sha256.New, cc.key)
+	h.Write([]byte(password))
+	return h.Sum(nil)
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"final/cmd/echo/models"
+	"fmt"
+	"io"
+)
+
+type exportService struct {
+	lists models.ListRepository
+	tasks models.TaskRepository
+}
+
+func NewExportService(repos models.Repositories) ExportService {
+	return &exportService{lists: repos.Lists, tasks: repos.Tasks}
+}
+
+func (s *exportService) Export(ctx context.Context, user models.User, w io.Writer, format models.ExportFormat, listID int) error {
+	if listID != 0 {
+		if err := owned(s.lists.OwnedBy(ctx, listID, user)); err != nil {
+			return err
+		}
+	}
+	return s.tasks.Export(ctx, user, w, format, listID)
+}
+
+func (s *exportService) Import(ctx context.Context, user models.User, r io.Reader, format models.ExportFormat, dryRun bool) (models.ImportReport, error) {
+	rows, problems, err := models.ParseImport(r, format)
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+
+	if len(problems) > 0 && !dryRun {
+		report := models.ImportReport{ListsCreated: []string{}, ListsReused: []string{}, Errors: problems}
+		return report, fmt.Errorf("%w: %d invalid rows", ErrImportRejected, len(problems))
+	}
+
+	report, err := s.tasks.Import(ctx, user, rows, dryRun)
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	report.Errors = append(report.Errors, problems...)
+	return report, nil
+}
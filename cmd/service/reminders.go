@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"final/cmd/echo/models"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Notifier tells the owner of a task that its reminder time has come.
+type Notifier interface {
+	Notify(ctx context.Context, reminder models.Reminder) error
+}
+
+// LogNotifier writes reminders to Logger, or the standard logger when it is
+// nil. It is the notifier when no other is configured.
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+func (n LogNotifier) Notify(ctx context.Context, reminder models.Reminder) error {
+	logf := log.Printf
+	if n.Logger != nil {
+		logf = n.Logger.Printf
+	}
+	logf("reminder for %s: task %d %q in list %q", reminder.Username, reminder.Task.ID, reminder.Task.Name, reminder.ListName)
+	return nil
+}
+
+// ReminderEvent is the event of the JSON body a WebhookNotifier posts.
+const ReminderEvent = "task.reminder"
+
+// WebhookNotifier posts every reminder as JSON to a URL. Any status other
+// than 2xx fails the notification.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder models.Reminder) error {
+	body, err := json.Marshal(struct {
+		Event string `json:"event"`
+		models.Reminder
+	}{ReminderEvent, reminder})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("reminder webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// the URL of a *url.Error may carry a secret token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("reminder webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder webhook: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ReminderScheduler sends the reminders that are due through a Notifier.
+type ReminderScheduler struct {
+	tasks    models.TaskRepository
+	notifier Notifier
+	now      func() time.Time
+}
+
+func NewReminderScheduler(repos models.Repositories, notifier Notifier) *ReminderScheduler {
+	return &ReminderScheduler{tasks: repos.Tasks, notifier: notifier, now: time.Now}
+}
+
+// Send notifies about every reminder that is due and returns how many went
+// out. A reminder is only marked as sent once its notification succeeded, so
+// a failed one is retried by the next Send. The first failure is returned
+// after the other reminders have been tried.
+func (s *ReminderScheduler) Send(ctx context.Context) (int, error) {
+	reminders, err := s.tasks.Reminders(ctx, s.now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var failed error
+	for _, reminder := range reminders {
+		if err := s.notifier.Notify(ctx, reminder); err != nil {
+			if failed == nil {
+				failed = fmt.Errorf("remind of task %d: %w", reminder.Task.ID, err)
+			}
+			continue
+		}
+		if err := s.tasks.MarkReminded(ctx, reminder.Task.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, failed
+}
@@ -0,0 +1,76 @@
+// Package service holds the business rules of the to-do app independent of
+// any web framework: who may see and change which lists and tasks, the signup
+// and password policy, and exports and imports. The echo and gin handlers
+// only translate HTTP to calls of these services and back.
+//
+// Every call takes the user it acts for. Lists and tasks of other users are
+// reported as ErrNotOwned, which is indistinguishable from a missing one.
+package service
+
+import (
+	"context"
+	"errors"
+	"final/cmd/echo/models"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotOwned wraps models.ErrNotFound.
+	ErrNotOwned       = fmt.Errorf("%w: not owned by the acting user", models.ErrNotFound)
+	ErrWrongPassword  = errors.New("current password is incorrect")
+	ErrImportRejected = errors.New("import rejected")
+)
+
+type TodoService interface {
+	Lists(ctx context.Context, user models.User, query models.PageQuery) ([]models.List, string, error)
+	CreateList(ctx context.Context, user models.User, name string) (models.List, error)
+	List(ctx context.Context, user models.User, id int) (models.List, error)
+	RenameList(ctx context.Context, user models.User, id int, name string) (models.List, error)
+	// DeleteList returns how many tasks were deleted with the list.
+	DeleteList(ctx context.Context, user models.User, id int) (int, error)
+
+	Tasks(ctx context.Context, user models.User, listID int, query models.PageQuery) ([]models.Task, string, error)
+	CreateTask(ctx context.Context, user models.User, listID int, task models.NewTask) (models.Task, error)
+	Task(ctx context.Context, user models.User, id int) (models.Task, error)
+	// UpdateTask may move the task only to another list of user.
+	UpdateTask(ctx context.Context, user models.User, id int, update models.TaskUpdate) (models.Task, error)
+	DeleteTask(ctx context.Context, user models.User, id int) error
+
+	Trash(ctx context.Context, user models.User) (models.Trash, error)
+	// RestoreList and RestoreTask fail with ErrNotOwned unless the list or
+	// task is in the trash of user.
+	RestoreList(ctx context.Context, user models.User, id int) (models.List, error)
+	RestoreTask(ctx context.Context, user models.User, id int) (models.Task, error)
+
+	Search(ctx context.Context, user models.User, query string, limit int) ([]models.SearchResult, error)
+	// DueTasks looks across all lists of user.
+	DueTasks(ctx context.Context, user models.User, query models.DueQuery) ([]models.Task, error)
+}
+
+type UserService interface {
+	SignUp(ctx context.Context, username, password string) (models.User, error)
+	// Authenticate reports whether password is the one of username.
+	Authenticate(ctx context.Context, username, password string) (models.User, bool, error)
+	User(ctx context.Context, id int) (models.User, error)
+	// ChangePassword fails with ErrWrongPassword unless current is the
+	// password of user.
+	ChangePassword(ctx context.Context, user models.User, current, password string) error
+	Delete(ctx context.Context, user models.User) error
+
+	// RevokeToken reports whether it revoked the token; false means it was
+	// revoked already.
+	RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+}
+
+type ExportService interface {
+	// Export writes the tasks of user in format, only those of one list when
+	// listID is not 0. Nothing is written when the list is not user's.
+	Export(ctx context.Context, user models.User, w io.Writer, format models.ExportFormat, listID int) error
+	// Import creates lists and tasks from r. Any invalid row rejects the whole
+	// import with ErrImportRejected, and the report lists all of them. A dry
+	// run stores nothing and reports invalid rows without failing.
+	Import(ctx context.Context, user models.User, r io.Reader, format models.ExportFormat, dryRun bool) (models.ImportReport, error)
+}
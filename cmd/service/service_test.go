@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"final/cmd/echo/models"
+	"final/cmd/internal/testdb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	_, repos := testdb.New(t)
+	users := NewUserService(repos, NewCredentialCache(time.Minute))
+	ctx := context.Background()
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	testdb.CreateUser(t, repos, "bob", "bobpass")
+
+	user, ok, err := users.Authenticate(ctx, "bob", "bobpass")
+	if assert.NoError(t, err) && assert.True(t, ok) {
+		assert.Equal(t, "bob", user.Username)
+		assert.Equal(t, 2, user.ID)
+	}
+
+	_, ok, err = users.Authenticate(ctx, "bob", "alicepass")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = users.Authenticate(ctx, "carol", "bobpass")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	cost, err := bcrypt.Cost(unknownUserHash())
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.PasswordCost, cost)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	_, repos := testdb.New(t)
+	users := NewUserService(repos, NewCredentialCache(time.Minute))
+	ctx := context.Background()
+	alice, err := users.SignUp(ctx, "alice", "alicepass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = users.SignUp(ctx, "alice", "otherpass")
+	assert.ErrorIs(t, err, models.ErrConflict)
+	var invalid *models.ValidationError
+	_, err = users.SignUp(ctx, "bob", "")
+	assert.ErrorAs(t, err, &invalid)
+
+	// warm the cache so the change has to evict the old password
+	if _, ok, _ := users.Authenticate(ctx, "alice", "alicepass"); !ok {
+		t.Fatal("expected alice to authenticate")
+	}
+
+	assert.ErrorIs(t, users.ChangePassword(ctx, alice, "wrong", "newpassword"), ErrWrongPassword)
+	assert.NoError(t, users.ChangePassword(ctx, alice, "alicepass", "newpassword"))
+
+	_, ok, err := users.Authenticate(ctx, "alice", "alicepass")
+	assert.NoError(t, err)
+	assert.False(t, ok, "the old password must stop working")
+	_, ok, _ = users.Authenticate(ctx, "alice", "newpassword")
+	assert.True(t, ok)
+}
+
+func TestOwnership(t *testing.T) {
+	_, repos := testdb.New(t)
+	todos := NewTodoService(repos)
+	ctx := context.Background()
+	alice := models.User{ID: 1, Username: "alice"}
+	bob := models.User{ID: 2, Username: "bob"}
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	testdb.CreateUser(t, repos, "bob", "bobpass")
+
+	groceries, err := todos.CreateList(ctx, alice, "groceries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	milk, err := todos.CreateTask(ctx, alice, groceries.ID, models.NewTask{Text: "milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chores, err := todos.CreateList(ctx, bob, "chores")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = todos.List(ctx, bob, groceries.ID)
+	assert.ErrorIs(t, err, ErrNotOwned)
+	assert.ErrorIs(t, err, models.ErrNotFound, "foreign lists must look like missing ones")
+	_, err = todos.CreateTask(ctx, bob, groceries.ID, models.NewTask{Text: "eggs"})
+	assert.ErrorIs(t, err, ErrNotOwned)
+	_, err = todos.Task(ctx, bob, milk.ID)
+	assert.ErrorIs(t, err, ErrNotOwned)
+	assert.ErrorIs(t, todos.DeleteTask(ctx, bob, milk.ID), ErrNotOwned)
+	_, err = todos.DeleteList(ctx, bob, groceries.ID)
+	assert.ErrorIs(t, err, ErrNotOwned)
+
+	_, err = todos.UpdateTask(ctx, alice, milk.ID, models.TaskUpdate{ListID: &chores.ID})
+	var invalid *models.ValidationError
+	if assert.ErrorAs(t, err, &invalid) {
+		assert.Equal(t, "listId", invalid.Field)
+	}
+
+	task, err := todos.Task(ctx, alice, milk.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, groceries.ID, task.ListID)
+	}
+}
+
+func TestTrashPurger(t *testing.T) {
+	_, repos := testdb.New(t)
+	todos := NewTodoService(repos)
+	ctx := context.Background()
+	alice := models.User{ID: 1, Username: "alice"}
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+
+	groceries, _ := todos.CreateList(ctx, alice, "groceries")
+	chores, _ := todos.CreateList(ctx, alice, "chores")
+	milk, _ := todos.CreateTask(ctx, alice, groceries.ID, models.NewTask{Text: "milk"})
+	todos.CreateTask(ctx, alice, chores.ID, models.NewTask{Text: "dishes"})
+	assert.NoError(t, todos.DeleteTask(ctx, alice, milk.ID))
+	_, err := todos.DeleteList(ctx, alice, chores.ID)
+	assert.NoError(t, err)
+
+	purger := NewTrashPurger(repos, 30*24*time.Hour)
+	purger.now = func() time.Time { return time.Now().Add(29 * 24 * time.Hour) }
+	lists, tasks, err := purger.Purge(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, lists+tasks, "nothing is old enough to be purged")
+
+	purger.now = func() time.Time { return time.Now().Add(31 * 24 * time.Hour) }
+	lists, tasks, err = purger.Purge(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lists)
+	assert.Equal(t, 1, tasks, "the tasks of a purged list are not counted")
+	trash, err := todos.Trash(ctx, alice)
+	if assert.NoError(t, err) {
+		assert.Empty(t, trash.Lists)
+		assert.Empty(t, trash.Tasks)
+	}
+}
+
+// fakeNotifier records reminders and fails those of the tasks in fail.
+type fakeNotifier struct {
+	sent []models.Reminder
+	fail map[int]bool
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, reminder models.Reminder) error {
+	if n.fail[reminder.Task.ID] {
+		return errors.New("unreachable")
+	}
+	n.sent = append(n.sent, reminder)
+	return nil
+}
+
+func TestReminders(t *testing.T) {
+	_, repos := testdb.New(t)
+	todos := NewTodoService(repos)
+	ctx := context.Background()
+	alice := models.User{ID: 1, Username: "alice"}
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+
+	work, _ := todos.CreateList(ctx, alice, "work")
+	soon := time.Now().Add(time.Minute)
+	standup, _ := todos.CreateTask(ctx, alice, work.ID, models.NewTask{Text: "standup", DueAt: &soon, RemindAt: &soon})
+	review, _ := todos.CreateTask(ctx, alice, work.ID, models.NewTask{Text: "review", RemindAt: &soon})
+
+	notifier := &fakeNotifier{fail: map[int]bool{review.ID: true}}
+	scheduler := NewReminderScheduler(repos, notifier)
+	sent, err := scheduler.Send(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent, "nothing is due yet")
+
+	scheduler.now = func() time.Time { return soon.Add(time.Second) }
+	sent, err = scheduler.Send(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unreachable")
+	}
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, notifier.sent, 1) {
+		assert.Equal(t, standup.ID, notifier.sent[0].Task.ID)
+		assert.Equal(t, "alice", notifier.sent[0].Username)
+		assert.Equal(t, "work", notifier.sent[0].ListName)
+	}
+
+	notifier.fail = nil
+	sent, err = scheduler.Send(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent, "only the failed reminder is sent again")
+	assert.Equal(t, review.ID, notifier.sent[1].Task.ID)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body map[string]interface{}
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL+"/hooks?token=secret", time.Second)
+	reminder := models.Reminder{Task: models.Task{ID: 7, Name: "standup"}, ListName: "work", UserID: 1, Username: "alice"}
+	if assert.NoError(t, notifier.Notify(context.Background(), reminder)) {
+		assert.Equal(t, ReminderEvent, body["event"])
+		assert.Equal(t, "alice", body["username"])
+		assert.Equal(t, "work", body["listName"])
+		assert.Equal(t, "standup", body["task"].(map[string]interface{})["text"])
+	}
+
+	status = http.StatusBadGateway
+	if err := notifier.Notify(context.Background(), reminder); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "status 502")
+	}
+
+	server.Close()
+	err := notifier.Notify(context.Background(), reminder)
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "secret", "the webhook URL must not leak into errors")
+	}
+}
+
+func TestImport(t *testing.T) {
+	db, repos := testdb.New(t)
+	exports := NewExportService(repos)
+	ctx := context.Background()
+	alice := models.User{ID: 1, Username: "alice"}
+	testdb.CreateUser(t, repos, "alice", "alicepass")
+	csv, _ := models.LookupExportFormat("csv")
+
+	input := "list,text,completed\ngroceries,milk,false\n,no list,false\n"
+	report, err := exports.Import(ctx, alice, strings.NewReader(input), csv, false)
+	assert.ErrorIs(t, err, ErrImportRejected)
+	assert.Len(t, report.Errors, 1)
+	lists, _ := models.GetLists(ctx, db, alice)
+	assert.Empty(t, lists, "a rejected import must store nothing")
+
+	report, err = exports.Import(ctx, alice, strings.NewReader(input), csv, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, report.TasksCreated)
+		assert.Len(t, report.Errors, 1)
+	}
+}
+
+func TestCredentialCache(t *testing.T) {
+	now := time.Now()
+	cache := NewCredentialCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	alice := models.User{ID: 1, Username: "alice"}
+	cache.Put("alice", "alicepass", alice)
+
+	user, ok := cache.Get("alice", "alicepass")
+	assert.True(t, ok)
+	assert.Equal(t, alice, user)
+
+	_, ok = cache.Get("alice", "wrong")
+	assert.False(t, ok, "a different password must not hit the cache")
+
+	now = now.Add(time.Minute)
+	_, ok = cache.Get("alice", "alicepass")
+	assert.False(t, ok, "expired entries must not hit the cache")
+
+	cache.Put("alice", "alicepass", alice)
+	cache.Forget("alice")
+	_, ok = cache.Get("alice", "alicepass")
+	assert.False(t, ok, "forgotten entries must not hit the cache")
+
+	var disabled *CredentialCache
+	disabled.Put("alice", "alicepass", alice)
+	_, ok = disabled.Get("alice", "alicepass")
+	assert.False(t, ok)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"final/cmd/echo/models"
+)
+
+type todoService struct {
+	lists models.ListRepository
+	tasks models.TaskRepository
+}
+
+func NewTodoService(repos models.Repositories) TodoService {
+	return &todoService{lists: repos.Lists, tasks: repos.Tasks}
+}
+
+func (s *todoService) Lists(ctx context.Context, user models.User, query models.PageQuery) ([]models.List, string, error) {
+	return s.lists.Lists(ctx, user, query)
+}
+
+func (s *todoService) CreateList(ctx context.Context, user models.User, name string) (models.List, error) {
+	return s.lists.Create(ctx, user, name)
+}
+
+func (s *todoService) List(ctx context.Context, user models.User, id int) (models.List, error) {
+	if err := owned(s.lists.OwnedBy(ctx, id, user)); err != nil {
+		return models.List{}, err
+	}
+	return s.lists.Get(ctx, id)
+}
+
+func (s *todoService) RenameList(ctx context.Context, user models.User, id int, name string) (models.List, error) {
+	if err := owned(s.lists.OwnedBy(ctx, id, user)); err != nil {
+		return models.List{}, err
+	}
+	return s.lists.Rename(ctx, id, name)
+}
+
+func (s *todoService) DeleteList(ctx context.Context, user models.User, id int) (int, error) {
+	if err := owned(s.lists.OwnedBy(ctx, id, user)); err != nil {
+		return 0, err
+	}
+	return s.lists.Delete(ctx, id)
+}
+
+func (s *todoService) Tasks(ctx context.Context, user models.User, listID int, query models.PageQuery) ([]models.Task, string, error) {
+	if err := owned(s.lists.OwnedBy(ctx, listID, user)); err != nil {
+		return nil, "", err
+	}
+	return s.tasks.Tasks(ctx, listID, query)
+}
+
+func (s *todoService) CreateTask(ctx context.Context, user models.User, listID int, task models.NewTask) (models.Task, error) {
+	if err := owned(s.lists.OwnedBy(ctx, listID, user)); err != nil {
+		return models.Task{}, err
+	}
+	return s.tasks.Create(ctx, listID, task)
+}
+
+func (s *todoService) Task(ctx context.Context, user models.User, id int) (models.Task, error) {
+	if err := owned(s.tasks.OwnedBy(ctx, id, user)); err != nil {
+		return models.Task{}, err
+	}
+	return s.tasks.Get(ctx, id)
+}
+
+func (s *todoService) UpdateTask(ctx context.Context, user models.User, id int, update models.TaskUpdate) (models.Task, error) {
+	if err := owned(s.tasks.OwnedBy(ctx, id, user)); err != nil {
+		return models.Task{}, err
+	}
+	if update.ListID != nil {
+		owned, err := s.lists.OwnedBy(ctx, *update.ListID, user)
+		if err != nil {
+			return models.Task{}, err
+		}
+		if !owned {
+			return models.Task{}, &models.ValidationError{Field: "listId", Message: "no such list"}
+		}
+	}
+	return s.tasks.Update(ctx, id, update)
+}
+
+func (s *todoService) DeleteTask(ctx context.Context, user models.User, id int) error {
+	if err := owned(s.tasks.OwnedBy(ctx, id, user)); err != nil {
+		return err
+	}
+	return s.tasks.Delete(ctx, id)
+}
+
+func (s *todoService) Trash(ctx context.Context, user models.User) (models.Trash, error) {
+	lists, err := s.lists.Trash(ctx, user)
+	if err != nil {
+		return models.Trash{}, err
+	}
+	tasks, err := s.tasks.Trash(ctx, user)
+	if err != nil {
+		return models.Trash{}, err
+	}
+	return models.Trash{Lists: lists, Tasks: tasks}, nil
+}
+
+func (s *todoService) RestoreList(ctx context.Context, user models.User, id int) (models.List, error) {
+	list, err := s.lists.Restore(ctx, user, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return models.List{}, ErrNotOwned
+	}
+	return list, err
+}
+
+func (s *todoService) RestoreTask(ctx context.Context, user models.User, id int) (models.Task, error) {
+	task, err := s.tasks.Restore(ctx, user, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return models.Task{}, ErrNotOwned
+	}
+	return task, err
+}
+
+func (s *todoService) Search(ctx context.Context, user models.User, query string, limit int) ([]models.SearchResult, error) {
+	return s.tasks.Search(ctx, user, query, limit)
+}
+
+func (s *todoService) DueTasks(ctx context.Context, user models.User, query models.DueQuery) ([]models.Task, error) {
+	return s.tasks.Due(ctx, user, query)
+}
+
+func owned(ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotOwned
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"final/cmd/echo/models"
+	"time"
+)
+
+// TrashPurger deletes what has been in the trash for longer than the
+// retention period for good.
+type TrashPurger struct {
+	lists     models.ListRepository
+	tasks     models.TaskRepository
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewTrashPurger(repos models.Repositories, retention time.Duration) *TrashPurger {
+	return &TrashPurger{lists: repos.Lists, tasks: repos.Tasks, retention: retention, now: time.Now}
+}
+
+// Purge returns how many lists and tasks it deleted. The tasks of a purged
+// list are not counted.
+func (p *TrashPurger) Purge(ctx context.Context) (int, int, error) {
+	cutoff := p.now().UTC().Add(-p.retention)
+
+	lists, err := p.lists.Purge(ctx, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	tasks, err := p.tasks.Purge(ctx, cutoff)
+	if err != nil {
+		return lists, 0, err
+	}
+	return lists, tasks, nil
+}
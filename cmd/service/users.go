@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"final/cmd/echo/models"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type userService struct {
+	users models.UserRepository
+	cache *CredentialCache
+}
+
+// NewUserService returns a UserService remembering verified credentials in
+// cache, which may be nil.
+func NewUserService(repos models.Repositories, cache *CredentialCache) UserService {
+	return &userService{users: repos.Users, cache: cache}
+}
+
+func (s *userService) SignUp(ctx context.Context, username, password string) (models.User, error) {
+	if err := models.ValidateUsername(username); err != nil {
+		return models.User{}, err
+	}
+	if err := models.ValidatePassword(username, password); err != nil {
+		return models.User{}, err
+	}
+	return s.users.Create(ctx, username, password)
+}
+
+func (s *userService) Authenticate(ctx context.Context, username, password string) (models.User, bool, error) {
+	if user, ok := s.cache.Get(username, password); ok {
+		return user, true, nil
+	}
+
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, models.ErrNotFound) {
+		// compare anyway so unknown usernames take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(unknownUserHash(), []byte(password))
+		return models.User{}, false, nil
+	}
+	if err != nil {
+		return models.User{}, false, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return models.User{}, false, nil
+	}
+
+	s.cache.Put(username, password, user)
+	return user, true, nil
+}
+
+var unknownUser struct {
+	once sync.Once
+	hash []byte
+}
+
+// unknownUserHash returns a hash at the configured cost to compare passwords
+// of unknown users against.
+func unknownUserHash() []byte {
+	unknownUser.once.Do(func() {
+		unknownUser.hash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), models.PasswordCost)
+	})
+	return unknownUser.hash
+}
+
+func (s *userService) User(ctx context.Context, id int) (models.User, error) {
+	return s.users.Get(ctx, id)
+}
+
+func (s *userService) ChangePassword(ctx context.Context, user models.User, current, password string) error {
+	// user may come from the credential cache, so read the stored hash
+	user, err := s.users.Get(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+		return ErrWrongPassword
+	}
+	if err := models.ValidatePassword(user.Username, password); err != nil {
+		return err
+	}
+
+	if err := s.users.UpdatePassword(ctx, user, password); err != nil {
+		return err
+	}
+	s.cache.Forget(user.Username)
+	return nil
+}
+
+func (s *userService) Delete(ctx context.Context, user models.User) error {
+	if err := s.users.Delete(ctx, user); err != nil {
+		return err
+	}
+	s.cache.Forget(user.Username)
+	return nil
+}
+
+func (s *userService) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	return s.users.RevokeToken(ctx, id, expiresAt)
+}
+
+func (s *userService) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return s.users.IsTokenRevoked(ctx, id)
+}